@@ -0,0 +1,366 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nxshock/torrentdb/sources"
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+// Максимальное кол-во результатов поиска на одной странице API
+const apiMaxLimit = 100
+
+type apiTorrent struct {
+	Title           string        `json:"title"`
+	Btih            string        `json:"btih"`
+	Size            uint64        `json:"size"`
+	PublicationTime time.Time     `json:"publication_time"`
+	Source          string        `json:"source"`
+	TopicID         int           `json:"topic_id"`
+	Category        string        `json:"category"`
+	Seeders         int           `json:"seeders"`
+	Leechers        int           `json:"leechers"`
+	Completed       int           `json:"completed"`
+	StatsTime       *time.Time    `json:"stats_time,omitempty"`
+	ChangeTime      *time.Time    `json:"change_time,omitempty"`
+	RemoveTime      *time.Time    `json:"remove_time,omitempty"`
+	Description     string        `json:"description"`
+	Files           []apiFile     `json:"files,omitempty"`
+	History         []apiRevision `json:"history,omitempty"`
+	Listings        []apiListing  `json:"listings,omitempty"`
+}
+
+type apiListing struct {
+	Source          string     `json:"source"`
+	TopicID         int        `json:"topic_id"`
+	URL             string     `json:"url"`
+	Title           string     `json:"title"`
+	PublicationTime time.Time  `json:"publication_time"`
+	Seeders         int        `json:"seeders"`
+	Leechers        int        `json:"leechers"`
+	RemoveTime      *time.Time `json:"remove_time,omitempty"`
+}
+
+type apiRevision struct {
+	Title       string    `json:"title"`
+	Btih        string    `json:"btih"`
+	Size        uint64    `json:"size"`
+	ReplaceTime time.Time `json:"replace_time"`
+}
+
+type apiFile struct {
+	Path string `json:"path"`
+	Size uint64 `json:"size"`
+}
+
+type apiSearchResponse struct {
+	Query          string        `json:"query"`
+	OrderBy        SortField     `json:"order_by"`
+	OrderDirection SortDirection `json:"order_direction"`
+	Categories     []string      `json:"categories,omitempty"`
+	Page           int           `json:"page"`
+	Limit          int           `json:"limit"`
+	Total          int           `json:"total"`
+	TotalIsMax     bool          `json:"total_is_max"`
+	Results        []*apiTorrent `json:"results"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// Интервал между попытками открыть источники, которые не удалось открыть
+const openSourcesRetryDelay = time.Minute
+
+var (
+	sourceNames     map[int]string
+	sourcesByID     map[int]sources.Source
+	openSourcesTime time.Time
+	sourcesLock     sync.Mutex
+)
+
+// openSources открывает источники для получения их имён и ссылок на темы.
+// Источники, которые не удалось открыть, открываются повторно не чаще
+// openSourcesRetryDelay. Вызывается с захваченным sourcesLock.
+func openSources() {
+	if sourceNames == nil {
+		sourceNames = make(map[int]string)
+		sourcesByID = make(map[int]sources.Source)
+	}
+
+	driverNames := sources.RegisteredDrivers()
+	if len(sourceNames) == len(driverNames) || time.Now().Before(openSourcesTime.Add(openSourcesRetryDelay)) {
+		return
+	}
+	openSourcesTime = time.Now()
+
+	opened := make(map[string]bool)
+	for _, driverName := range sourceNames {
+		opened[driverName] = true
+	}
+
+	for _, driverName := range driverNames {
+		if opened[driverName] {
+			continue
+		}
+
+		source, err := openSource(driverName)
+		if err != nil {
+			log.Printf("Open source %s error: %v", driverName, err)
+			continue
+		}
+
+		sourceNames[source.ID()] = driverName
+		sourcesByID[source.ID()] = source
+	}
+}
+
+// sourceName возвращает имя драйвера источника по его ID
+func sourceName(sourceID int) string {
+	sourcesLock.Lock()
+	defer sourcesLock.Unlock()
+
+	openSources()
+
+	return sourceNames[sourceID]
+}
+
+// topicURL возвращает ссылку на тему источника, пустую для неизвестного источника
+func topicURL(sourceID int, topicID int) string {
+	sourcesLock.Lock()
+	openSources()
+	source := sourcesByID[sourceID]
+	sourcesLock.Unlock()
+
+	if source == nil {
+		return ""
+	}
+
+	return source.TopicURL(topicID)
+}
+
+func newApiTorrent(t *torrent.Torrent) *apiTorrent {
+	var statsTime *time.Time
+	if t.HasStats() {
+		statsTime = &t.Stats.UpdateTime
+	}
+
+	var changeTime *time.Time
+	if t.IsChanged() {
+		changeTime = &t.ChangeTime
+	}
+
+	var removeTime *time.Time
+	if t.IsRemoved() {
+		removeTime = &t.RemoveTime
+	}
+
+	return &apiTorrent{
+		Title:           t.Title,
+		Btih:            t.BtihHex(),
+		Size:            t.Size,
+		PublicationTime: t.PublicationTime,
+		Source:          sourceName(t.SourceID),
+		TopicID:         t.TopicID,
+		Category:        t.Category.String(),
+		Seeders:         t.Seeders,
+		Leechers:        t.Leechers,
+		Completed:       t.Completed,
+		StatsTime:       statsTime,
+		ChangeTime:      changeTime,
+		RemoveTime:      removeTime,
+		Description:     string(t.Body)}
+}
+
+func newApiListings(listings []torrent.Listing) []apiListing {
+	apiListings := make([]apiListing, 0, len(listings))
+	for _, listing := range listings {
+		var removeTime *time.Time
+		if listing.IsRemoved() {
+			removeTime = &listing.RemoveTime
+		}
+
+		apiListings = append(apiListings, apiListing{
+			Source:          sourceName(listing.SourceID),
+			TopicID:         listing.TopicID,
+			URL:             topicURL(listing.SourceID, listing.TopicID),
+			Title:           listing.Title,
+			PublicationTime: listing.PublicationTime,
+			Seeders:         listing.Seeders,
+			Leechers:        listing.Leechers,
+			RemoveTime:      removeTime})
+	}
+
+	return apiListings
+}
+
+func newApiFiles(files []torrent.File) []apiFile {
+	apiFiles := make([]apiFile, 0, len(files))
+	for _, file := range files {
+		apiFiles = append(apiFiles, apiFile{Path: file.Path, Size: file.Size})
+	}
+
+	return apiFiles
+}
+
+func apiSearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.FormValue("query"))
+	if query == "" {
+		writeApiError(w, http.StatusBadRequest, "empty query")
+		return
+	}
+
+	response := apiSearchResponse{
+		Query:          query,
+		OrderBy:        SortField(r.FormValue("orderBy")),
+		OrderDirection: SortDirection(r.FormValue("orderDirection")),
+		Page:           1,
+		Limit:          config.Main.SearchPageSize,
+		Results:        []*apiTorrent{}}
+
+	if response.Limit > apiMaxLimit {
+		response.Limit = apiMaxLimit
+	}
+
+	if response.OrderBy == "" {
+		response.OrderBy = FieldTime
+	} else if !response.OrderBy.IsValid() {
+		writeApiError(w, http.StatusBadRequest, "invalid orderBy value")
+		return
+	}
+
+	if response.OrderDirection != "" && !response.OrderDirection.IsValid() {
+		writeApiError(w, http.StatusBadRequest, "invalid orderDirection value")
+		return
+	}
+
+	// Список категорий через запятую
+	var categories []torrent.Category
+	if s := r.FormValue("category"); s != "" {
+		for _, name := range strings.Split(s, ",") {
+			category, err := torrent.ParseCategory(strings.TrimSpace(name))
+			if err != nil {
+				writeApiError(w, http.StatusBadRequest, "invalid category value")
+				return
+			}
+
+			categories = append(categories, category)
+			response.Categories = append(response.Categories, category.String())
+		}
+	}
+
+	var err error
+	if s := r.FormValue("page"); s != "" {
+		response.Page, err = strconv.Atoi(s)
+		if err != nil || response.Page < 1 {
+			writeApiError(w, http.StatusBadRequest, "invalid page value")
+			return
+		}
+	}
+
+	if s := r.FormValue("limit"); s != "" {
+		response.Limit, err = strconv.Atoi(s)
+		if err != nil || response.Limit < 1 || response.Limit > apiMaxLimit {
+			writeApiError(w, http.StatusBadRequest, "invalid limit value")
+			return
+		}
+	}
+
+	torrents, err := db.SearchTorrentsByTitle(query, categories, response.OrderBy, response.OrderDirection, response.Limit, (response.Page-1)*response.Limit)
+	if err != nil {
+		log.Printf("API search error: %v", err)
+		writeApiError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+
+	response.Total, err = db.CountTorrentsByTitle(query, categories, searchMaxCount)
+	if err != nil {
+		log.Printf("API search error: %v", err)
+		writeApiError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	response.TotalIsMax = response.Total >= searchMaxCount
+
+	for _, t := range torrents {
+		response.Results = append(response.Results, newApiTorrent(t))
+	}
+
+	writeApiResponse(w, http.StatusOK, response)
+}
+
+func apiTorrentHandler(w http.ResponseWriter, r *http.Request) {
+	btih, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/api/v1/torrent/"))
+	if err != nil || len(btih) == 0 {
+		writeApiError(w, http.StatusBadRequest, "invalid btih")
+		return
+	}
+
+	t, err := db.SearchTorrentByBtih(btih)
+	if err == sql.ErrNoRows {
+		writeApiError(w, http.StatusNotFound, "torrent not found")
+		return
+	} else if err != nil {
+		writeApiError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+
+	files, err := db.GetFiles(t.SourceID, t.TopicID)
+	if err != nil {
+		writeApiError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+
+	listings, err := db.GetListings(btih)
+	if err != nil {
+		writeApiError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+
+	response := newApiTorrent(t)
+	response.Files = newApiFiles(files)
+	response.Listings = newApiListings(listings)
+
+	if t.IsChanged() {
+		history, err := db.GetHistory(t.SourceID, t.TopicID)
+		if err != nil {
+			writeApiError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		for _, revision := range history {
+			response.History = append(response.History, apiRevision{
+				Title:       revision.Title,
+				Btih:        revision.BtihHex(),
+				Size:        revision.Size,
+				ReplaceTime: revision.ReplaceTime})
+		}
+	}
+
+	writeApiResponse(w, http.StatusOK, response)
+}
+
+func apiNotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeApiError(w, http.StatusNotFound, "unknown API method")
+}
+
+func writeApiResponse(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("Write API response error: %v", err)
+	}
+}
+
+func writeApiError(w http.ResponseWriter, statusCode int, message string) {
+	writeApiResponse(w, statusCode, apiError{Error: message})
+}
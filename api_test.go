@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+// serveTestRequest выполняет запрос к обработчику и возвращает ответ
+func serveTestRequest(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+	return w
+}
+
+func TestApiSearchHandler(t *testing.T) {
+	newTestDb(t)
+
+	insertTestTorrent(t, testSourceID, 1, "Movie one", 1, torrent.CategoryMovies)
+	insertTestTorrent(t, testSourceID, 2, "Movie two", 2, torrent.CategoryTV)
+	insertTestTorrent(t, testSourceID, 3, "Movie three", 3, torrent.CategoryTV)
+
+	w := serveTestRequest(apiSearchHandler, "/api/v1/search?query=movie&category=tv&limit=1&page=2&orderBy=name")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var response apiSearchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "movie", response.Query)
+	assert.Equal(t, FieldName, response.OrderBy)
+	assert.Equal(t, []string{"tv"}, response.Categories)
+	assert.Equal(t, 2, response.Page)
+	assert.Equal(t, 1, response.Limit)
+	assert.Equal(t, 2, response.Total)
+	assert.False(t, response.TotalIsMax)
+	if assert.Len(t, response.Results, 1) {
+		result := response.Results[0]
+		assert.Equal(t, "Movie two", result.Title)
+		assert.Equal(t, "02", result.Btih)
+		assert.Equal(t, "test", result.Source)
+		assert.Equal(t, 2, result.TopicID)
+		assert.Equal(t, "tv", result.Category)
+	}
+
+	// Пустой результат возвращается пустым списком
+	w = serveTestRequest(apiSearchHandler, "/api/v1/search?query=missing")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"results":[]`)
+}
+
+func TestApiSearchHandlerErrors(t *testing.T) {
+	newTestDb(t)
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"/api/v1/search", "empty query"},
+		{"/api/v1/search?query=+", "empty query"},
+		{"/api/v1/search?query=a&orderBy=title", "invalid orderBy value"},
+		{"/api/v1/search?query=a&orderDirection=up", "invalid orderDirection value"},
+		{"/api/v1/search?query=a&category=movies,cartoons", "invalid category value"},
+		{"/api/v1/search?query=a&page=0", "invalid page value"},
+		{"/api/v1/search?query=a&page=x", "invalid page value"},
+		{"/api/v1/search?query=a&limit=101", "invalid limit value"},
+	}
+
+	for _, test := range tests {
+		w := serveTestRequest(apiSearchHandler, test.target)
+		assert.Equal(t, http.StatusBadRequest, w.Code, test.target)
+		assert.JSONEq(t, `{"error": "`+test.expected+`"}`, w.Body.String(), test.target)
+	}
+}
+
+func TestApiTorrentHandler(t *testing.T) {
+	newTestDb(t)
+
+	insertTestTorrent(t, testSourceID, 1, "Movie", 0xab, torrent.CategoryMovies)
+
+	w := serveTestRequest(apiTorrentHandler, "/api/v1/torrent/AB")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response apiTorrent
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Movie", response.Title)
+	assert.Equal(t, "ab", response.Btih)
+	assert.Equal(t, "movies", response.Category)
+	assert.Nil(t, response.RemoveTime)
+	assert.Equal(t, []apiFile{{Path: "Folder/Movie.mkv", Size: 1}}, response.Files)
+	if assert.Len(t, response.Listings, 1) {
+		assert.Equal(t, "test", response.Listings[0].Source)
+		assert.Equal(t, "http://test/1", response.Listings[0].URL)
+	}
+
+	// Изменённый на источнике торрент возвращается с историей
+	insertTestTorrent(t, testSourceID, 1, "Movie (new)", 0xab, torrent.CategoryMovies)
+
+	w = serveTestRequest(apiTorrentHandler, "/api/v1/torrent/ab")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	response = apiTorrent{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Movie (new)", response.Title)
+	assert.NotNil(t, response.ChangeTime)
+	if assert.Len(t, response.History, 1) {
+		assert.Equal(t, "Movie", response.History[0].Title)
+	}
+
+	tests := []struct {
+		target     string
+		statusCode int
+		expected   string
+	}{
+		{"/api/v1/torrent/", http.StatusBadRequest, "invalid btih"},
+		{"/api/v1/torrent/xyz", http.StatusBadRequest, "invalid btih"},
+		{"/api/v1/torrent/cd", http.StatusNotFound, "torrent not found"},
+	}
+
+	for _, test := range tests {
+		w := serveTestRequest(apiTorrentHandler, test.target)
+		assert.Equal(t, test.statusCode, w.Code, test.target)
+		assert.JSONEq(t, `{"error": "`+test.expected+`"}`, w.Body.String(), test.target)
+	}
+
+	w = serveTestRequest(apiNotFoundHandler, "/api/v2/search")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "unknown API method"}`, w.Body.String())
+}
+
+func TestSourceNameRetry(t *testing.T) {
+	newTestDb(t)
+
+	sourcesLock.Lock()
+	sourceNames, sourcesByID, openSourcesTime = nil, nil, time.Time{}
+	sourcesLock.Unlock()
+
+	testDriverErr = errors.New("open error")
+	defer func() { testDriverErr = nil }()
+
+	assert.Equal(t, "", sourceName(testSourceID))
+	assert.Equal(t, "", topicURL(testSourceID, 1))
+
+	// Источник не открывается повторно до истечения интервала
+	testDriverErr = nil
+	assert.Equal(t, "", sourceName(testSourceID))
+
+	sourcesLock.Lock()
+	openSourcesTime = time.Time{}
+	sourcesLock.Unlock()
+
+	assert.Equal(t, "test", sourceName(testSourceID))
+	assert.Equal(t, "http://test/1", topicURL(testSourceID, 1))
+}
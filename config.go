@@ -2,10 +2,15 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"path/filepath"
+	"time"
 
 	"github.com/BurntSushi/toml"
+
+	"github.com/nxshock/torrentdb/render"
+	"github.com/nxshock/torrentdb/sources"
 )
 
 var config *Config
@@ -13,22 +18,137 @@ var config *Config
 type Config struct {
 	Main MainConfig
 
+	// Параметры HTTP-сервера
+	Server ServerConfig
+
 	// Параметры подключения к БД
 	Database DatabaseConfig
+
+	// Расписание задач демона по источникам
+	Schedule map[string]ScheduleConfig
+
+	// Параметры источников: общие поля SourceConfig и параметры драйвера
+	Sources map[string]toml.Primitive
+
+	// Декодированные параметры источников
+	sourceConfigs map[string]*SourceConfig
 }
 
 type MainConfig struct {
 	// Путь к каталогу с данными сайта
 	SiteDir string
 
-	// Адрес прокси-сервера
+	// Адрес прокси-сервера, может быть переопределён для источника
 	ProxyAddr string
 
+	// Обработка изображений в описаниях: allow, proxy или block
+	DescriptionImages string
+
+	// Кол-во результатов поиска на одной странице
+	SearchPageSize int
+
+	// Ключ API для Torznab, пустое значение отключает проверку
+	TorznabApiKey string
+
+	// Кол-во потоков при обновлении базы данных, может быть переопределено для источника
+	UpdateThreadCount int
+
+	// Кол-во обработанных ID, после которого фиксируется транзакция
+	// и сохраняется контрольная точка обновления
+	UpdateBatchSize int
+
+	// Задержка перед первой повторной попыткой получения торрента,
+	// каждая следующая задержка в два раза больше предыдущей
+	RetryBaseDelay Duration
+
+	// Кол-во попыток, после которого ID больше не запрашивается
+	RetryMaxAttempts int
+
+	// Статистика раздач обновляется для торрентов, опубликованных
+	// не раньше указанного срока
+	StatsMaxAge Duration
+
+	// Таймаут запроса к трекеру при получении статистики
+	ScrapeTimeout Duration
+
+	// Максимальное кол-во торрентов, проверяемых за один запуск refresh
+	RefreshLimit int
+
+	// Таймаут одной попытки запроса к источнику
+	RequestTimeout Duration
+
+	// Кол-во повторов запроса к источнику при ответах 429/5xx и таймаутах
+	RequestRetries int
+
+	// Заголовок User-Agent запросов к источникам
+	UserAgent string
+}
+
+// Расписание задается как интервал ("6h"), cron-выражение ("0 3 * * *")
+// или описатель ("@daily"). Пустое значение отключает задачу.
+type ScheduleConfig struct {
+	// Расписание загрузки новых торрентов
+	Update string
+
+	// Расписание обновления статистики раздач
+	Stats string
+
+	// Расписание опроса трекеров
+	Scrape string
+
+	// Расписание повторной проверки загруженных торрентов
+	Refresh string
+}
+
+// Параметры источника, не зависящие от драйвера
+type SourceConfig struct {
+	// Участие источника в командах для всех источников и задачах демона
+	Enabled bool
+
 	// Кол-во потоков при обновлении базы данных
 	UpdateThreadCount int
+
+	// Параметры драйвера, декодируются из той же секции
+	Options sources.DriverOptions `toml:"-"`
+}
+
+// Продолжительность в формате time.ParseDuration ("1h30m")
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+
+	return err
+}
+
+type ServerConfig struct {
+	// Адреса для входящих подключений
+	Listen []string
+
+	// Пути к сертификату и ключу TLS, при пустых значениях используется http
+	TLSCert string
+	TLSKey  string
+
+	// Таймауты обработки запросов
+	ReadTimeout  Duration
+	WriteTimeout Duration
+	IdleTimeout  Duration
+
+	// Время ожидания завершения текущих запросов при остановке
+	ShutdownTimeout Duration
 }
 
 type DatabaseConfig struct {
+	// Драйвер БД: postgres или sqlite
+	Driver string
+
+	// Путь к файлу БД (только для sqlite)
+	Path string
+
+	// Параметры подключения (только для postgres)
 	User     string
 	Password string
 	Host     string
@@ -44,13 +164,22 @@ func initConfig(configFilePath string) error {
 
 	log.Printf("Reading config file: %s...", absConfigFilePath)
 
-	_, err = toml.DecodeFile(defaultConfigPath, &config)
+	md, err := toml.DecodeFile(defaultConfigPath, &config)
 	if err != nil {
 		return err
 	}
 
 	config.ApplyDefaults()
 
+	err = config.decodeSources(md)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range md.Undecoded() {
+		log.Printf("Unknown config key %s ignored", key)
+	}
+
 	err = config.Validate()
 	if err != nil {
 		return err
@@ -64,10 +193,82 @@ func (config *Config) ApplyDefaults() {
 		config.Main.SiteDir = defaultSitePath
 	}
 
+	if config.Main.DescriptionImages == "" {
+		config.Main.DescriptionImages = render.ImagesProxy
+	}
+
+	if config.Main.SearchPageSize <= 0 {
+		config.Main.SearchPageSize = 100
+	}
+
 	if config.Main.UpdateThreadCount <= 0 {
 		config.Main.UpdateThreadCount = 1
 	}
 
+	if config.Main.UpdateBatchSize <= 0 {
+		config.Main.UpdateBatchSize = 100
+	}
+
+	if config.Main.RetryBaseDelay.Duration <= 0 {
+		config.Main.RetryBaseDelay.Duration = 10 * time.Minute
+	}
+
+	if config.Main.RetryMaxAttempts <= 0 {
+		config.Main.RetryMaxAttempts = 8
+	}
+
+	if config.Main.StatsMaxAge.Duration <= 0 {
+		config.Main.StatsMaxAge.Duration = 30 * 24 * time.Hour
+	}
+
+	if config.Main.ScrapeTimeout.Duration <= 0 {
+		config.Main.ScrapeTimeout.Duration = 15 * time.Second
+	}
+
+	if config.Main.RefreshLimit <= 0 {
+		config.Main.RefreshLimit = 1000
+	}
+
+	if config.Main.RequestTimeout.Duration <= 0 {
+		config.Main.RequestTimeout.Duration = 30 * time.Second
+	}
+
+	if config.Main.RequestRetries <= 0 {
+		config.Main.RequestRetries = 3
+	}
+
+	if config.Main.UserAgent == "" {
+		config.Main.UserAgent = "Mozilla/5.0 (compatible; torrentdb)"
+	}
+
+	if len(config.Server.Listen) == 0 {
+		config.Server.Listen = []string{":80"}
+	}
+
+	if config.Server.ReadTimeout.Duration <= 0 {
+		config.Server.ReadTimeout.Duration = 30 * time.Second
+	}
+
+	if config.Server.WriteTimeout.Duration <= 0 {
+		config.Server.WriteTimeout.Duration = 60 * time.Second
+	}
+
+	if config.Server.IdleTimeout.Duration <= 0 {
+		config.Server.IdleTimeout.Duration = 120 * time.Second
+	}
+
+	if config.Server.ShutdownTimeout.Duration <= 0 {
+		config.Server.ShutdownTimeout.Duration = 30 * time.Second
+	}
+
+	if config.Database.Driver == "" {
+		config.Database.Driver = DriverPostgres
+	}
+
+	if config.Database.Path == "" {
+		config.Database.Path = defaultSqlitePath
+	}
+
 	if config.Database.Host == "" {
 		config.Database.Host = "localhost"
 	}
@@ -80,13 +281,98 @@ func (config *Config) ApplyDefaults() {
 func (config *Config) Validate() error {
 	log.Println("Validating config...")
 
-	if config.Database.User == "" {
-		return errors.New("empty database username, check config.Database.User field")
+	switch config.Main.DescriptionImages {
+	case render.ImagesAllow, render.ImagesProxy, render.ImagesBlock:
+	default:
+		return fmt.Errorf("unknown description images mode %q, check config.Main.DescriptionImages field", config.Main.DescriptionImages)
+	}
+
+	if (config.Server.TLSCert == "") != (config.Server.TLSKey == "") {
+		return errors.New("both TLS certificate and key must be set, check config.Server.TLSCert and config.Server.TLSKey fields")
+	}
+
+	for sourceName, sourceConfig := range config.sourceConfigs {
+		err := sourceConfig.Options.Validate()
+		if err != nil {
+			return fmt.Errorf("%v, check config.Sources.%s section", err, sourceName)
+		}
+	}
+
+	switch config.Database.Driver {
+	case DriverPostgres:
+		if config.Database.User == "" {
+			return errors.New("empty database username, check config.Database.User field")
+		}
+
+		if config.Database.DbName == "" {
+			return errors.New("empty database name, check config.Database.DbName field")
+		}
+	case DriverSqlite:
+	default:
+		return fmt.Errorf("unknown database driver %q, check config.Database.Driver field", config.Database.Driver)
+	}
+
+	return nil
+}
+
+// decodeSources декодирует секции источников в параметры драйверов.
+// Общие параметры запросов из секции Main используются как значения по умолчанию.
+func (config *Config) decodeSources(md toml.MetaData) error {
+	registeredDrivers := make(map[string]bool)
+	for _, driverName := range sources.RegisteredDrivers() {
+		registeredDrivers[driverName] = true
 	}
 
-	if config.Database.DbName == "" {
-		return errors.New("empty database name, check config.Database.DbName field")
+	for sourceName := range config.Sources {
+		if !registeredDrivers[sourceName] {
+			return fmt.Errorf("unknown source %q, check config.Sources section", sourceName)
+		}
+	}
+
+	config.sourceConfigs = make(map[string]*SourceConfig)
+
+	for driverName := range registeredDrivers {
+		options, err := sources.NewOptions(driverName)
+		if err != nil {
+			return err
+		}
+
+		common := options.Common()
+		common.Timeout = config.Main.RequestTimeout.Duration
+		common.MaxRetries = config.Main.RequestRetries
+		common.UserAgent = config.Main.UserAgent
+		common.DataDir = filepath.Dir(defaultSqlitePath)
+
+		sourceConfig := &SourceConfig{Enabled: true, Options: options}
+
+		if primitive, ok := config.Sources[driverName]; ok {
+			err = md.PrimitiveDecode(primitive, sourceConfig)
+			if err != nil {
+				return fmt.Errorf("config.Sources.%s: %v", driverName, err)
+			}
+
+			err = md.PrimitiveDecode(primitive, options)
+			if err != nil {
+				return fmt.Errorf("config.Sources.%s: %v", driverName, err)
+			}
+		}
+
+		// Пустые значения источника заменяются значениями из секции Main,
+		// прокси отключается для источника явным значением sources.ProxyDirect
+		if common.ProxyAddr == "" {
+			common.ProxyAddr = config.Main.ProxyAddr
+		}
+		if sourceConfig.UpdateThreadCount <= 0 {
+			sourceConfig.UpdateThreadCount = config.Main.UpdateThreadCount
+		}
+
+		config.sourceConfigs[driverName] = sourceConfig
 	}
 
 	return nil
 }
+
+// Source возвращает параметры источника или nil для незарегистрированного источника
+func (config *Config) Source(driverName string) *SourceConfig {
+	return config.sourceConfigs[driverName]
+}
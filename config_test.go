@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/sources"
+	"github.com/nxshock/torrentdb/sources/rutracker"
+)
+
+func TestDecodeSources(t *testing.T) {
+	const data = `
+[Main]
+ProxyAddr = "127.0.0.1:9050"
+UpdateThreadCount = 16
+
+[Sources.rutor]
+Enabled = false
+ProxyAddr = "direct"
+UpdateThreadCount = 2
+RequestsPerSecond = 2.5
+
+[Sources.rutracker]
+ProxyAddr = ""
+Login = "user"
+
+[Sources.test]
+ProxyAddr = "127.0.0.1:9150"
+`
+
+	config = new(Config)
+	md, err := toml.Decode(data, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ApplyDefaults()
+
+	assert.NoError(t, config.decodeSources(md))
+	assert.Empty(t, md.Undecoded())
+
+	rutor := config.Source("rutor")
+	if assert.NotNil(t, rutor) {
+		assert.False(t, rutor.Enabled)
+		assert.Equal(t, 2, rutor.UpdateThreadCount)
+		assert.Equal(t, 2.5, rutor.Options.Common().RequestsPerSecond)
+		assert.Equal(t, sources.ProxyDirect, rutor.Options.Common().ProxyAddr)
+	}
+
+	// Пустой адрес прокси источника не отменяет адрес из секции Main
+	rutrackerConfig := config.Source("rutracker")
+	if assert.NotNil(t, rutrackerConfig) {
+		assert.True(t, rutrackerConfig.Enabled)
+		assert.Equal(t, 16, rutrackerConfig.UpdateThreadCount)
+		assert.Equal(t, "127.0.0.1:9050", rutrackerConfig.Options.Common().ProxyAddr)
+
+		options, ok := rutrackerConfig.Options.(*rutracker.Options)
+		if assert.True(t, ok) {
+			assert.Equal(t, "user", options.Login)
+		}
+	}
+
+	assert.Equal(t, "127.0.0.1:9150", config.Source("test").Options.Common().ProxyAddr)
+	assert.Nil(t, config.Source("unknown"))
+
+	assert.NotContains(t, enabledSources(), "rutor")
+	assert.Contains(t, enabledSources(), "rutracker")
+}
+
+func TestDecodeSourcesUnknownSource(t *testing.T) {
+	config = new(Config)
+	md, err := toml.Decode("[Sources.unknown]\nEnabled = true\n", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ApplyDefaults()
+
+	assert.EqualError(t, config.decodeSources(md), `unknown source "unknown", check config.Sources section`)
+}
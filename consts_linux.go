@@ -3,5 +3,7 @@ package main
 const (
 	defaultConfigPath = "/etc/torrentdb.toml"
 
+	defaultSqlitePath = "/var/lib/torrentdb/torrentdb.db"
+
 	defaultSitePath = "/usr/lib/torrentdb"
 )
@@ -3,5 +3,7 @@ package main
 const (
 	defaultConfigPath = "torrentdb.toml"
 
+	defaultSqlitePath = "torrentdb.db"
+
 	defaultSitePath = "./site"
 )
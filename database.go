@@ -2,108 +2,329 @@ package main
 
 import (
 	"database/sql"
-	"fmt"
 	"html/template"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nxshock/torrentdb/torrent"
 )
 
+// Поля таблицы info, считываемые queryTorrents
+const torrentColumns = "source_id, topic_id, title, btih, description, publication_time, size, category, source_category_id, seeders, leechers, completed, stats_time, tracker_seeders, tracker_leechers, tracker_completed, tracker_stats_time, change_time, remove_time"
+
+// Кол-во сидов для сортировки - большее из значений источника и трекеров, как в displayStats
+const seedersExpr = "CASE WHEN tracker_seeders > seeders THEN tracker_seeders ELSE seeders END"
+
+// Условие отбора основной записи среди тем разных источников с одинаковым хешем:
+// предпочтение отдаётся доступным на источнике темам, затем меньшим ID источника и темы
+const canonicalCondition = `NOT EXISTS (
+	SELECT 1 FROM info AS other WHERE other.btih = info.btih AND (
+		(other.remove_time IS NULL AND info.remove_time IS NOT NULL) OR
+		((other.remove_time IS NULL) = (info.remove_time IS NULL) AND
+			(other.source_id < info.source_id OR (other.source_id = info.source_id AND other.topic_id < info.topic_id)))))`
+
+// Общая для всех драйверов часть хранилища на основе database/sql.
+// Запросы здесь должны быть совместимы со всеми поддерживаемыми СУБД.
 type Database struct {
-	db *sql.DB
+	db         *sql.DB
+	migrations []migration
 }
 
-var (
-	db *Database
-)
+func (database *Database) Close() error {
+	return database.db.Close()
+}
 
-func initDb() error {
-	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", config.Database.User, config.Database.Password, config.Database.Host, config.Database.Port, config.Database.DbName) // TODO: экранирование?
+func (database *Database) Begin() (*sql.Tx, error) {
+	return database.db.Begin()
+}
 
-	log.Printf("Connecting to database %s...", dbURL)
+// SearchTorrentByBtih возвращает основную запись торрента с указанным хешем
+func (database *Database) SearchTorrentByBtih(btih []byte) (*torrent.Torrent, error) {
+	torrents, err := database.queryTorrents("SELECT "+torrentColumns+" FROM info WHERE btih = $1 AND "+canonicalCondition+" LIMIT 1", btih)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
 
-	var err error
-	db, err = newDatabase("postgres", dbURL)
+	if len(torrents) == 0 {
+		return nil, sql.ErrNoRows
+	}
 
-	return err
+	return torrents[0], nil
 }
 
-func newDatabase(driver, address string) (*Database, error) {
-	db, err := sql.Open(driver, address)
+func (database *Database) InsertTorrent(sourceID int, topicID int, torrent *torrent.Torrent) error {
+	tx, err := database.db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &Database{db}, nil
+	err = database.InsertTorrentWithTx(tx, sourceID, topicID, torrent)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (database *Database) Close() error {
-	return database.db.Close()
+// InsertTorrentWithTx добавляет торрент или обновляет уже загруженный.
+// При изменении названия, хеша или размера предыдущие значения сохраняются в истории.
+func (database *Database) InsertTorrentWithTx(transaction *sql.Tx, sourceID int, topicID int, torrent *torrent.Torrent) error {
+	now := time.Now()
+
+	// Предыдущие значения сохраняются до их замены, для новой темы строк не будет
+	sql := "INSERT INTO info_history (source_id, topic_id, title, btih, size, replace_time) SELECT source_id, topic_id, title, btih, size, $3 FROM info WHERE source_id = $1 AND topic_id = $2 AND (title <> $4 OR btih <> $5 OR size <> $6)"
+
+	_, err := transaction.Exec(sql, sourceID, topicID, now, torrent.Title, torrent.Btih, torrent.Size)
+	if err != nil {
+		return err
+	}
+
+	// Успешно полученная тема снова считается доступной на источнике,
+	// статистика обновляется, только если источник её вернул
+	sql = `INSERT INTO info (source_id, topic_id, title, btih, description, publication_time, size, category, source_category_id, seeders, leechers, completed, stats_time, refresh_time)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT (source_id, topic_id) DO UPDATE SET
+	change_time = CASE WHEN info.title <> excluded.title OR info.btih <> excluded.btih OR info.size <> excluded.size THEN excluded.refresh_time ELSE info.change_time END,
+	title = excluded.title, btih = excluded.btih, description = excluded.description, publication_time = excluded.publication_time, size = excluded.size,
+	category = excluded.category, source_category_id = excluded.source_category_id,
+	seeders = CASE WHEN excluded.stats_time IS NULL THEN info.seeders ELSE excluded.seeders END,
+	leechers = CASE WHEN excluded.stats_time IS NULL THEN info.leechers ELSE excluded.leechers END,
+	completed = CASE WHEN excluded.stats_time IS NULL THEN info.completed ELSE excluded.completed END,
+	stats_time = COALESCE(excluded.stats_time, info.stats_time),
+	refresh_time = excluded.refresh_time, remove_time = NULL`
+
+	_, err = transaction.Exec(sql, sourceID, topicID, torrent.Title, torrent.Btih, string(torrent.Body), torrent.PublicationTime, torrent.Size, torrent.Category, torrent.SourceCategoryID,
+		torrent.Seeders, torrent.Leechers, torrent.Completed, nullTime(torrent.Stats.UpdateTime), now)
+	if err != nil {
+		return err
+	}
+
+	// Списки файлов и трекеров заменяются целиком
+	_, err = transaction.Exec("DELETE FROM file WHERE source_id = $1 AND topic_id = $2", sourceID, topicID)
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec("DELETE FROM tracker WHERE source_id = $1 AND topic_id = $2", sourceID, topicID)
+	if err != nil {
+		return err
+	}
+
+	err = database.insertFilesWithTx(transaction, sourceID, topicID, torrent.Files)
+	if err != nil {
+		return err
+	}
+
+	return database.insertTrackersWithTx(transaction, sourceID, topicID, torrent.Trackers)
 }
 
-func (database *Database) SearchTorrentByBtih(btih []byte) (*torrent.Torrent, error) {
-	var (
-		title           string
-		description     string
-		publicationTime time.Time
-		size            uint64
-	)
+func (database *Database) insertFilesWithTx(transaction *sql.Tx, sourceID int, topicID int, files []torrent.File) error {
+	if len(files) == 0 {
+		return nil
+	}
 
-	err := database.db.QueryRow("SELECT title, description, publication_time, size FROM info WHERE btih = $1::bytea", btih).Scan(&title, &description, &publicationTime, &size)
+	stmt, err := transaction.Prepare("INSERT INTO file (source_id, topic_id, path, size) VALUES ($1, $2, $3, $4)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, file := range files {
+		_, err = stmt.Exec(sourceID, topicID, file.Path, file.Size)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (database *Database) insertTrackersWithTx(transaction *sql.Tx, sourceID int, topicID int, trackers []string) error {
+	if len(trackers) == 0 {
+		return nil
+	}
+
+	stmt, err := transaction.Prepare("INSERT INTO tracker (source_id, topic_id, url) VALUES ($1, $2, $3)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	seen := make(map[string]bool)
+	for _, tracker := range trackers {
+		if seen[tracker] {
+			continue
+		}
+		seen[tracker] = true
+
+		_, err = stmt.Exec(sourceID, topicID, tracker)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetScrapeTargets возвращает трекеры торрентов источника, опубликованных не раньше since
+func (database *Database) GetScrapeTargets(sourceID int, since time.Time) (targets []*ScrapeTarget, err error) {
+	sql := `SELECT tracker.topic_id, info.btih, tracker.url FROM tracker
+JOIN info ON info.source_id = tracker.source_id AND info.topic_id = tracker.topic_id
+WHERE tracker.source_id = $1 AND info.publication_time >= $2
+ORDER BY tracker.url, tracker.topic_id`
+
+	rows, err := database.db.Query(sql, sourceID, since)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		target := &ScrapeTarget{SourceID: sourceID}
+
+		err = rows.Scan(&target.TopicID, &target.Btih, &target.Tracker)
+		if err != nil {
+			return nil, err
+		}
 
-	t := &torrent.Torrent{Title: title, Body: template.HTML(description), PublicationTime: publicationTime, Size: size, Btih: btih}
+		targets = append(targets, target)
+	}
 
-	return t, nil
+	return targets, rows.Err()
 }
 
-func (database *Database) InsertTorrent(sourceID int, topicID int, torrent *torrent.Torrent) error {
-	sql := "INSERT INTO info (source_id, topic_id, title, btih, description, publication_time, size) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+func (database *Database) UpdateTrackerStatsWithTx(transaction *sql.Tx, target *ScrapeTarget, stats *torrent.Stats) error {
+	sql := "UPDATE tracker SET seeders = $1, leechers = $2, completed = $3, scrape_time = $4 WHERE source_id = $5 AND topic_id = $6 AND url = $7"
 
-	_, err := db.db.Exec(sql, sourceID, topicID, torrent.Title, torrent.Btih, torrent.Body, torrent.PublicationTime, torrent.Size)
+	_, err := transaction.Exec(sql, stats.Seeders, stats.Leechers, stats.Completed, nullTime(stats.UpdateTime), target.SourceID, target.TopicID, target.Tracker)
 
 	return err
 }
 
-func (database *Database) InsertTorrentWithTx(transaction *sql.Tx, sourceID int, topicID int, torrent *torrent.Torrent) error {
-	sql := "INSERT INTO info (source_id, topic_id, title, btih, description, publication_time, size) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+// UpdateTopicTrackerStatsWithTx сохраняет статистику торрента по данным трекеров
+// отдельно от статистики источника
+func (database *Database) UpdateTopicTrackerStatsWithTx(transaction *sql.Tx, sourceID int, topicID int, stats *torrent.Stats) error {
+	sql := "UPDATE info SET tracker_seeders = $1, tracker_leechers = $2, tracker_completed = $3, tracker_stats_time = $4 WHERE source_id = $5 AND topic_id = $6"
 
-	_, err := transaction.Exec(sql, sourceID, topicID, torrent.Title, torrent.Btih, torrent.Body, torrent.PublicationTime, torrent.Size)
+	_, err := transaction.Exec(sql, stats.Seeders, stats.Leechers, stats.Completed, nullTime(stats.UpdateTime), sourceID, topicID)
 
 	return err
 }
 
-func (database *Database) SearchTorrentsByTitle(query string, sortField SortField, sortDirection SortDirection) (torrents []*torrent.Torrent, err error) {
-	sql := "SELECT title, btih, description, publication_time, size FROM info WHERE to_tsvector('russian', title) @@ plainto_tsquery($1::text)"
+// GetHistory возвращает предыдущие версии торрента, начиная с последней
+func (database *Database) GetHistory(sourceID int, topicID int) (history []torrent.Revision, err error) {
+	rows, err := database.db.Query("SELECT title, btih, size, replace_time FROM info_history WHERE source_id = $1 AND topic_id = $2 ORDER BY replace_time DESC", sourceID, topicID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var revision torrent.Revision
+
+		err = rows.Scan(&revision.Title, &revision.Btih, &revision.Size, &revision.ReplaceTime)
+		if err != nil {
+			return nil, err
+		}
+
+		history = append(history, revision)
+	}
+
+	return history, rows.Err()
+}
+
+// GetListings возвращает все темы источников с указанным хешем,
+// основная запись торрента идёт первой
+func (database *Database) GetListings(btih []byte) (listings []torrent.Listing, err error) {
+	query := "SELECT source_id, topic_id, title, publication_time, seeders, leechers, completed, stats_time, remove_time FROM info WHERE btih = $1 ORDER BY remove_time IS NOT NULL, source_id, topic_id"
+
+	rows, err := database.db.Query(query, btih)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			listing    torrent.Listing
+			statsTime  sql.NullTime
+			removeTime sql.NullTime
+		)
+
+		err = rows.Scan(&listing.SourceID, &listing.TopicID, &listing.Title, &listing.PublicationTime,
+			&listing.Seeders, &listing.Leechers, &listing.Completed, &statsTime, &removeTime)
+		if err != nil {
+			return nil, err
+		}
+		listing.Stats.UpdateTime = statsTime.Time
+		listing.RemoveTime = removeTime.Time
+
+		listings = append(listings, listing)
+	}
+
+	return listings, rows.Err()
+}
 
-	switch sortField {
-	case FieldName, FieldSize:
-		sql += " ORDER BY " + string(sortField)
-	case FieldTime:
-		sql += " ORDER BY publication_time"
-	default:
-		sortField = FieldTime
-		sql += " ORDER BY publication_time"
+// GetFiles возвращает список файлов торрента
+func (database *Database) GetFiles(sourceID int, topicID int) (files []torrent.File, err error) {
+	rows, err := database.db.Query("SELECT path, size FROM file WHERE source_id = $1 AND topic_id = $2 ORDER BY path", sourceID, topicID)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file torrent.File
 
-	switch sortDirection {
-	case SortDirectionAsc, SortDirectionDesc:
-		sql += " " + string(sortDirection)
-	default:
-		if sortField == FieldTime {
-			sql += " " + string(SortDirectionDesc)
-		} else {
-			sql += " " + string(SortDirectionAsc)
+		err = rows.Scan(&file.Path, &file.Size)
+		if err != nil {
+			return nil, err
 		}
+
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// GetLatestTorrents возвращает последние опубликованные торренты
+// из указанных категорий (из всех, если список пуст), по одной записи на хеш
+func (database *Database) GetLatestTorrents(categories []torrent.Category, limit int, offset int) ([]*torrent.Torrent, error) {
+	sql := "SELECT " + torrentColumns + " FROM info WHERE " + canonicalCondition
+
+	condition, args := categoryCondition(categories, 3)
+	if condition != "" {
+		sql += " AND " + condition
 	}
 
-	sql += " LIMIT 100"
+	sql += " ORDER BY publication_time DESC LIMIT $1 OFFSET $2"
 
-	rows, err := database.db.Query(sql, query)
+	return database.queryTorrents(sql, append([]interface{}{limit, offset}, args...)...)
+}
+
+// categoryCondition возвращает условие отбора по списку категорий
+// с параметрами, пронумерованными начиная с firstArg
+func categoryCondition(categories []torrent.Category, firstArg int) (string, []interface{}) {
+	if len(categories) == 0 {
+		return "", nil
+	}
+
+	placeholders := make([]string, 0, len(categories))
+	args := make([]interface{}, 0, len(categories))
+	for i, category := range categories {
+		placeholders = append(placeholders, "$"+strconv.Itoa(firstArg+i))
+		args = append(args, int(category))
+	}
+
+	return "category IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+func (database *Database) queryTorrents(query string, args ...interface{}) (torrents []*torrent.Torrent, err error) {
+	rows, err := database.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -111,22 +332,133 @@ func (database *Database) SearchTorrentsByTitle(query string, sortField SortFiel
 
 	for rows.Next() {
 		var (
+			sourceID        int
+			topicID         int
 			title           string
 			btih            []byte
 			description     string
 			publicationTime time.Time
 			size            uint64
+			category        torrent.Category
+			sourceCategory  int
+			stats           torrent.Stats
+			statsTime       sql.NullTime
+			trackerStats    torrent.Stats
+			trackerTime     sql.NullTime
+			changeTime      sql.NullTime
+			removeTime      sql.NullTime
 		)
 
-		err := rows.Scan(&title, &btih, &description, &publicationTime, &size)
+		err := rows.Scan(&sourceID, &topicID, &title, &btih, &description, &publicationTime, &size, &category, &sourceCategory,
+			&stats.Seeders, &stats.Leechers, &stats.Completed, &statsTime,
+			&trackerStats.Seeders, &trackerStats.Leechers, &trackerStats.Completed, &trackerTime, &changeTime, &removeTime)
 		if err != nil {
 			return nil, err
 		}
+		stats.UpdateTime = statsTime.Time
+		trackerStats.UpdateTime = trackerTime.Time
 
-		torrents = append(torrents, &torrent.Torrent{Title: title, Body: template.HTML(description), PublicationTime: publicationTime, Size: size, Btih: btih})
+		torrents = append(torrents, &torrent.Torrent{SourceID: sourceID, TopicID: topicID, Title: title, Body: template.HTML(description), PublicationTime: publicationTime, Size: size, Btih: btih, Category: category, SourceCategoryID: sourceCategory, Stats: displayStats(stats, trackerStats), ChangeTime: changeTime.Time, RemoveTime: removeTime.Time})
 	}
 
-	return torrents, nil
+	return torrents, rows.Err()
+}
+
+// GetRecentTopicIDs возвращает ID торрентов источника, опубликованных не раньше since
+func (database *Database) GetRecentTopicIDs(sourceID int, since time.Time) (ids []int, err error) {
+	rows, err := database.db.Query("SELECT topic_id FROM info WHERE source_id = $1 AND publication_time >= $2 ORDER BY topic_id", sourceID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (database *Database) UpdateStatsWithTx(transaction *sql.Tx, sourceID int, topicID int, stats *torrent.Stats) error {
+	sql := "UPDATE info SET seeders = $1, leechers = $2, completed = $3, stats_time = $4 WHERE source_id = $5 AND topic_id = $6"
+
+	_, err := transaction.Exec(sql, stats.Seeders, stats.Leechers, stats.Completed, nullTime(stats.UpdateTime), sourceID, topicID)
+
+	return err
+}
+
+// GetRefreshTopicIDs возвращает ID доступных на источнике торрентов, опубликованных
+// в интервале [from, to) и не проверявшихся с refreshedBefore, начиная с самых новых
+func (database *Database) GetRefreshTopicIDs(sourceID int, from, to time.Time, refreshedBefore time.Time, limit int) (ids []int, err error) {
+	sql := "SELECT topic_id FROM info WHERE source_id = $1 AND publication_time >= $2 AND publication_time < $3 AND remove_time IS NULL AND (refresh_time IS NULL OR refresh_time < $4) ORDER BY publication_time DESC LIMIT $5"
+
+	rows, err := database.db.Query(sql, sourceID, from, to, refreshedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// SetRefreshTimeWithTx сохраняет время проверки торрента без изменения данных
+func (database *Database) SetRefreshTimeWithTx(transaction *sql.Tx, sourceID int, topicID int, refreshTime time.Time) error {
+	_, err := transaction.Exec("UPDATE info SET refresh_time = $1 WHERE source_id = $2 AND topic_id = $3", refreshTime, sourceID, topicID)
+
+	return err
+}
+
+// MarkRemovedWithTx отмечает торрент удалённым на источнике,
+// время первого обнаружения удаления сохраняется
+func (database *Database) MarkRemovedWithTx(transaction *sql.Tx, sourceID int, topicID int, removeTime time.Time) error {
+	_, err := transaction.Exec("UPDATE info SET remove_time = COALESCE(remove_time, $1), refresh_time = $1 WHERE source_id = $2 AND topic_id = $3", removeTime, sourceID, topicID)
+
+	return err
+}
+
+// displayStats возвращает выводимую статистику торрента: источник и трекеры
+// обновляются независимо, поэтому берутся большие из известных значений
+func displayStats(sourceStats, trackerStats torrent.Stats) torrent.Stats {
+	if trackerStats.UpdateTime.IsZero() {
+		return sourceStats
+	}
+	if sourceStats.UpdateTime.IsZero() {
+		return trackerStats
+	}
+
+	stats := torrent.Stats{
+		Seeders:    maxInt(sourceStats.Seeders, trackerStats.Seeders),
+		Leechers:   maxInt(sourceStats.Leechers, trackerStats.Leechers),
+		Completed:  maxInt(sourceStats.Completed, trackerStats.Completed),
+		UpdateTime: sourceStats.UpdateTime}
+	if trackerStats.UpdateTime.After(stats.UpdateTime) {
+		stats.UpdateTime = trackerStats.UpdateTime
+	}
+
+	return stats
+}
+
+// nullTime преобразует нулевое время в NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
 }
 
 func (database *Database) GetMaxTorrentID(sourceID int) (int, error) {
@@ -138,3 +470,72 @@ func (database *Database) GetMaxTorrentID(sourceID int) (int, error) {
 
 	return maxTorrentID, nil
 }
+
+// GetCheckpoint возвращает последний обработанный при обновлении ID
+func (database *Database) GetCheckpoint(sourceID int) (int, error) {
+	var topicID int
+	err := database.db.QueryRow("SELECT topic_id FROM checkpoint WHERE source_id = $1", sourceID).Scan(&topicID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return topicID, nil
+}
+
+func (database *Database) SetCheckpointWithTx(transaction *sql.Tx, sourceID int, topicID int) error {
+	sql := "INSERT INTO checkpoint (source_id, topic_id, update_time) VALUES ($1, $2, $3) ON CONFLICT (source_id) DO UPDATE SET topic_id = excluded.topic_id, update_time = excluded.update_time"
+
+	_, err := transaction.Exec(sql, sourceID, topicID, time.Now())
+
+	return err
+}
+
+func (database *Database) GetFailedTopics(sourceID int) (failedTopics []*FailedTopic, err error) {
+	rows, err := database.db.Query("SELECT topic_id, error_class, error, attempts, last_attempt FROM failed_topic WHERE source_id = $1 ORDER BY topic_id", sourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		failedTopic := &FailedTopic{SourceID: sourceID}
+
+		err := rows.Scan(&failedTopic.TopicID, &failedTopic.ErrorClass, &failedTopic.Error, &failedTopic.Attempts, &failedTopic.LastAttempt)
+		if err != nil {
+			return nil, err
+		}
+
+		failedTopics = append(failedTopics, failedTopic)
+	}
+
+	return failedTopics, rows.Err()
+}
+
+func (database *Database) RecordFailure(sourceID int, topicID int, failErr error) error {
+	_, err := database.db.Exec(recordFailureSQL, sourceID, topicID, errorClass(failErr), failErr.Error(), time.Now())
+
+	return err
+}
+
+func (database *Database) RecordFailureWithTx(transaction *sql.Tx, sourceID int, topicID int, failErr error) error {
+	_, err := transaction.Exec(recordFailureSQL, sourceID, topicID, errorClass(failErr), failErr.Error(), time.Now())
+
+	return err
+}
+
+const recordFailureSQL = "INSERT INTO failed_topic (source_id, topic_id, error_class, error, attempts, last_attempt) VALUES ($1, $2, $3, $4, 1, $5) ON CONFLICT (source_id, topic_id) DO UPDATE SET error_class = excluded.error_class, error = excluded.error, attempts = failed_topic.attempts + 1, last_attempt = excluded.last_attempt"
+
+func (database *Database) DeleteFailure(sourceID int, topicID int) error {
+	_, err := database.db.Exec("DELETE FROM failed_topic WHERE source_id = $1 AND topic_id = $2", sourceID, topicID)
+
+	return err
+}
+
+func (database *Database) DeleteFailureWithTx(transaction *sql.Tx, sourceID int, topicID int) error {
+	_, err := transaction.Exec("DELETE FROM failed_topic WHERE source_id = $1 AND topic_id = $2", sourceID, topicID)
+
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+type PostgresDatabase struct {
+	*Database
+}
+
+func newPostgresDatabase(dbConfig DatabaseConfig) (*PostgresDatabase, error) {
+	dbURL := &url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(dbConfig.User, dbConfig.Password),
+		Host:     fmt.Sprintf("%s:%d", dbConfig.Host, dbConfig.Port),
+		Path:     dbConfig.DbName,
+		RawQuery: "sslmode=disable"}
+
+	database, err := newDatabase(DriverPostgres, dbURL.String(), postgresMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostgresDatabase{database}, nil
+}
+
+// Запрос хешей торрентов, найденных по названию или именам файлов, $1 - текст запроса.
+// Условия разделены через UNION, чтобы каждое использовало свой GIN-индекс.
+// Найденные темы сворачиваются по хешу до основной записи (canonicalCondition),
+// поэтому торрент находится по названию любой из его тем.
+const postgresSearchQuery = `SELECT btih FROM info WHERE to_tsvector('russian', title) @@ plainto_tsquery($1::text)
+	UNION
+	SELECT info.btih FROM file JOIN info ON info.source_id = file.source_id AND info.topic_id = file.topic_id
+	WHERE to_tsvector('russian', translate(file.path, '/._-[]()', '        ')) @@ plainto_tsquery($1::text)`
+
+func (database *PostgresDatabase) SearchTorrentsByTitle(query string, categories []torrent.Category, sortField SortField, sortDirection SortDirection, limit int, offset int) (torrents []*torrent.Torrent, err error) {
+	sql := "SELECT " + torrentColumns + " FROM info WHERE btih IN (" + postgresSearchQuery + ") AND " + canonicalCondition
+
+	condition, args := categoryCondition(categories, 4)
+	if condition != "" {
+		sql += " AND " + condition
+	}
+
+	sql += orderBy(sortField, sortDirection)
+	sql += " LIMIT $2 OFFSET $3"
+
+	return database.queryTorrents(sql, append([]interface{}{query, limit, offset}, args...)...)
+}
+
+func (database *PostgresDatabase) CountTorrentsByTitle(query string, categories []torrent.Category, maxCount int) (int, error) {
+	sql := "SELECT 1 FROM info WHERE btih IN (" + postgresSearchQuery + ") AND " + canonicalCondition
+
+	condition, args := categoryCondition(categories, 3)
+	if condition != "" {
+		sql += " AND " + condition
+	}
+
+	sql = "SELECT count(*) FROM (" + sql + " LIMIT $2) AS t"
+
+	var count int
+	err := database.db.QueryRow(sql, append([]interface{}{query, maxCount}, args...)...).Scan(&count)
+
+	return count, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+type SqliteDatabase struct {
+	*Database
+}
+
+func newSqliteDatabase(dbConfig DatabaseConfig) (*SqliteDatabase, error) {
+	dsn := "file:" + dbConfig.Path + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+
+	database, err := newDatabase(DriverSqlite, dsn, sqliteMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SqliteDatabase{database}, nil
+}
+
+// Условие поиска по названию и именам файлов, $1 - запрос FTS5.
+// Найденные темы сворачиваются по хешу до основной записи (canonicalCondition),
+// поэтому торрент находится по названию любой из его тем.
+const sqliteSearchCondition = `rowid IN (
+	SELECT rowid FROM info_fts WHERE info_fts MATCH $1
+	UNION
+	SELECT info.rowid FROM info JOIN file ON file.source_id = info.source_id AND file.topic_id = info.topic_id
+	WHERE file.rowid IN (SELECT rowid FROM file_fts WHERE file_fts MATCH $1))`
+
+func (database *SqliteDatabase) SearchTorrentsByTitle(query string, categories []torrent.Category, sortField SortField, sortDirection SortDirection, limit int, offset int) (torrents []*torrent.Torrent, err error) {
+	ftsQuery := ftsQuery(query)
+	if ftsQuery == "" {
+		return nil, nil
+	}
+
+	sql := "SELECT " + torrentColumns + " FROM info WHERE btih IN (SELECT btih FROM info WHERE " + sqliteSearchCondition + ") AND " + canonicalCondition
+
+	condition, args := categoryCondition(categories, 4)
+	if condition != "" {
+		sql += " AND " + condition
+	}
+
+	sql += orderBy(sortField, sortDirection)
+	sql += " LIMIT $2 OFFSET $3"
+
+	return database.queryTorrents(sql, append([]interface{}{ftsQuery, limit, offset}, args...)...)
+}
+
+func (database *SqliteDatabase) CountTorrentsByTitle(query string, categories []torrent.Category, maxCount int) (int, error) {
+	ftsQuery := ftsQuery(query)
+	if ftsQuery == "" {
+		return 0, nil
+	}
+
+	sql := "SELECT 1 FROM info WHERE btih IN (SELECT btih FROM info WHERE " + sqliteSearchCondition + ") AND " + canonicalCondition
+
+	condition, args := categoryCondition(categories, 3)
+	if condition != "" {
+		sql += " AND " + condition
+	}
+
+	sql = "SELECT count(*) FROM (" + sql + " LIMIT $2) AS t"
+
+	var count int
+	err := database.db.QueryRow(sql, append([]interface{}{ftsQuery, maxCount}, args...)...).Scan(&count)
+
+	return count, err
+}
+
+// ftsQuery преобразует пользовательский запрос в запрос FTS5,
+// в котором все слова должны присутствовать (аналог plainto_tsquery)
+func ftsQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nxshock/torrentdb/sources"
+)
+
+// Классы ошибок получения торрентов
+const (
+	ErrorClassNotFound     = "not_found"
+	ErrorClassDeleted      = "deleted"
+	ErrorClassAccessDenied = "access_denied"
+	ErrorClassRateLimited  = "rate_limited"
+	ErrorClassParseFailed  = "parse_failed"
+	ErrorClassTransient    = "transient"
+	ErrorClassTimeout      = "timeout"
+	ErrorClassNetwork      = "network"
+	ErrorClassOther        = "other"
+)
+
+// Классы ошибок драйверов источников
+var sourceErrorClasses = []struct {
+	err   error
+	class string
+}{
+	{sources.ErrNotFound, ErrorClassNotFound},
+	{sources.ErrDeleted, ErrorClassDeleted},
+	{sources.ErrAccessDenied, ErrorClassAccessDenied},
+	{sources.ErrRateLimited, ErrorClassRateLimited},
+	{sources.ErrParseFailed, ErrorClassParseFailed},
+	{sources.ErrTransient, ErrorClassTransient}}
+
+// ID торрента, который не удалось получить
+type FailedTopic struct {
+	SourceID    int
+	TopicID     int
+	ErrorClass  string
+	Error       string
+	Attempts    int
+	LastAttempt time.Time
+}
+
+// NextAttempt возвращает время, раньше которого повторять попытку не нужно
+func (failedTopic *FailedTopic) NextAttempt() time.Time {
+	delay := config.Main.RetryBaseDelay.Duration
+	for i := 1; i < failedTopic.Attempts && delay < 30*24*time.Hour; i++ {
+		delay *= 2
+	}
+
+	return failedTopic.LastAttempt.Add(delay)
+}
+
+func errorClass(err error) string {
+	for _, v := range sourceErrorClasses {
+		if errors.Is(err, v.err) {
+			return v.class
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClassTimeout
+		}
+
+		return ErrorClassNetwork
+	}
+
+	return ErrorClassOther
+}
+
+// isMissing сообщает, что торрент отсутствует на источнике и запрашивать его повторно не нужно
+func isMissing(err error) bool {
+	return errors.Is(err, sources.ErrNotFound) || errors.Is(err, sources.ErrDeleted)
+}
+
+// Кол-во ошибок по классам
+type errorCounts map[string]int
+
+func (counts errorCounts) Add(err error) {
+	counts[errorClass(err)]++
+}
+
+// String возвращает список вида "not_found: 2, timeout: 1" в порядке имён классов
+func (counts errorCounts) String() string {
+	var classes []string
+	for class := range counts {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	var items []string
+	for _, class := range classes {
+		items = append(items, fmt.Sprintf("%s: %d", class, counts[class]))
+	}
+
+	return strings.Join(items, ", ")
+}
+
+func retryFailedAll() {
+	drivers := enabledSources()
+	for _, driverName := range drivers {
+		err := retryFailed(driverName)
+		if err == errUpdateInterrupted {
+			log.Printf("%s: %v", driverName, err)
+			return
+		} else if err != nil {
+			log.Printf("Retry %s failed torrents error: %v", driverName, err)
+		}
+	}
+}
+
+func retryFailed(driverName string) error {
+	source, err := openSource(driverName)
+	if err != nil {
+		return err
+	}
+
+	failedTopics, err := db.GetFailedTopics(source.ID())
+	if err != nil {
+		return err
+	}
+
+	var (
+		ids         []int
+		giveUpCount int
+	)
+	for _, failedTopic := range failedTopics {
+		if failedTopic.Attempts >= config.Main.RetryMaxAttempts {
+			giveUpCount++
+			continue
+		}
+
+		if failedTopic.NextAttempt().After(time.Now()) {
+			continue
+		}
+
+		ids = append(ids, failedTopic.TopicID)
+	}
+
+	log.Printf("%s: %d failed torrents, %d to retry, %d given up.", driverName, len(failedTopics), len(ids), giveUpCount)
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var (
+		fixedCount   int
+		missingCount int
+		errorCount   int
+		errorClasses = make(errorCounts)
+	)
+
+	threadCount := config.Source(driverName).UpdateThreadCount
+
+	err = fetchTorrents(source, threadCount, idList(ids), func(results chan parseResult) error {
+		for result := range results {
+			err := saveRetryResult(source.ID(), result)
+			if err != nil {
+				return err
+			}
+
+			if result.err == nil {
+				fixedCount++
+			} else {
+				errorClasses.Add(result.err)
+				if isMissing(result.err) {
+					missingCount++
+				} else {
+					errorCount++
+				}
+			}
+
+			if showProgress {
+				fmt.Fprintf(os.Stderr, "\rProcessed %d / %d (fixed: %d, missing: %d, errors: %d)...", fixedCount+missingCount+errorCount, len(ids), fixedCount, missingCount, errorCount)
+			}
+		}
+		if showProgress {
+			fmt.Fprintf(os.Stderr, "\n")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(errorClasses) > 0 {
+		log.Printf("Errors by class: %v.", errorClasses)
+	}
+
+	log.Printf("Retry of %s failed torrents completed.", driverName)
+
+	return nil
+}
+
+func saveRetryResult(sourceID int, result parseResult) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Отсутствующие на источнике торренты больше не запрашиваются
+	if isMissing(result.err) {
+		err = db.DeleteFailureWithTx(tx, sourceID, result.id)
+	} else if result.err != nil {
+		err = db.RecordFailureWithTx(tx, sourceID, result.id, result.err)
+	} else {
+		err = db.InsertTorrentWithTx(tx, sourceID, result.id, result.torrent)
+		if err == nil {
+			err = db.DeleteFailureWithTx(tx, sourceID, result.id)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("save torrent %d: %v", result.id, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/sources"
+)
+
+func TestFailedTopicNextAttempt(t *testing.T) {
+	config = new(Config)
+	config.Main.RetryBaseDelay.Duration = 10 * time.Minute
+
+	lastAttempt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 10 * time.Minute},
+		{2, 20 * time.Minute},
+		{3, 40 * time.Minute},
+		{8, 1280 * time.Minute},
+		{20, 10 * time.Minute << 13}, // задержка перестаёт расти после превышения 30 дней
+		{1000, 10 * time.Minute << 13},
+	}
+
+	for _, test := range tests {
+		failedTopic := &FailedTopic{Attempts: test.attempts, LastAttempt: lastAttempt}
+		assert.Equal(t, lastAttempt.Add(test.expected), failedTopic.NextAttempt(), "%d", test.attempts)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{fmt.Errorf("topic 1: %w", sources.ErrNotFound), ErrorClassNotFound},
+		{fmt.Errorf("topic 1: %w", sources.ErrDeleted), ErrorClassDeleted},
+		{sources.ErrAccessDenied, ErrorClassAccessDenied},
+		{sources.ErrRateLimited, ErrorClassRateLimited},
+		{sources.ParseError(errors.New("no title")), ErrorClassParseFailed},
+		{sources.ErrTransient, ErrorClassTransient},
+		{&net.DNSError{IsTimeout: true}, ErrorClassTimeout},
+		{&net.DNSError{}, ErrorClassNetwork},
+		{errors.New("unknown"), ErrorClassOther},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, errorClass(test.err), "%v", test.err)
+	}
+
+	counts := make(errorCounts)
+	counts.Add(sources.ErrTransient)
+	counts.Add(sources.ErrNotFound)
+	counts.Add(sources.ErrTransient)
+	assert.Equal(t, "not_found: 1, transient: 2", counts.String())
+}
+
+func TestRecordFailure(t *testing.T) {
+	newTestDb(t)
+
+	before := time.Now().Add(-time.Second)
+
+	assert.NoError(t, db.RecordFailure(testSourceID, 1, sources.ErrTransient))
+	assert.NoError(t, db.RecordFailure(testSourceID, 1, sources.ErrRateLimited))
+
+	failedTopics, err := db.GetFailedTopics(testSourceID)
+	assert.NoError(t, err)
+	if assert.Len(t, failedTopics, 1) {
+		assert.Equal(t, 2, failedTopics[0].Attempts)
+		assert.Equal(t, ErrorClassRateLimited, failedTopics[0].ErrorClass)
+
+		// Время попытки не сдвигается часовым поясом при чтении из базы
+		lastAttempt := failedTopics[0].LastAttempt
+		assert.True(t, lastAttempt.After(before) && lastAttempt.Before(time.Now().Add(time.Second)), "%v", lastAttempt)
+	}
+
+	assert.NoError(t, db.DeleteFailure(testSourceID, 1))
+
+	failedTopics, err = db.GetFailedTopics(testSourceID)
+	assert.NoError(t, err)
+	assert.Empty(t, failedTopics)
+}
+
+func TestRetryFailed(t *testing.T) {
+	newTestDb(t)
+	config.Main.RetryBaseDelay.Duration = time.Nanosecond
+	config.Main.RetryMaxAttempts = 2
+
+	currentTestSource = &testSource{
+		errs: map[int]error{
+			2: sources.ErrTransient,
+			3: sources.ErrNotFound,
+			4: sources.ErrTransient}}
+	defer func() { currentTestSource = new(testSource) }()
+
+	for _, id := range []int{1, 2, 3} {
+		assert.NoError(t, db.RecordFailure(testSourceID, id, sources.ErrTransient))
+	}
+	// Попытки по ID 4 исчерпаны
+	for i := 0; i < config.Main.RetryMaxAttempts; i++ {
+		assert.NoError(t, db.RecordFailure(testSourceID, 4, sources.ErrTransient))
+	}
+
+	err := retryFailed("test")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []int{1}, topicIDs(t))
+
+	failedTopics, err := db.GetFailedTopics(testSourceID)
+	assert.NoError(t, err)
+
+	attempts := make(map[int]int)
+	for _, failedTopic := range failedTopics {
+		attempts[failedTopic.TopicID] = failedTopic.Attempts
+	}
+	assert.Equal(t, map[int]int{2: 2, 4: 2}, attempts)
+}
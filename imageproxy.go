@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Прокси для изображений из описаний торрентов. Ссылки подписываются,
+// чтобы прокси нельзя было использовать для загрузки произвольных адресов.
+
+const imageProxyMaxSize = 10 << 20
+
+var (
+	imageProxyKey = make([]byte, 32)
+
+	imageProxyClient = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: 10 * time.Second,
+				Control: denyPrivateAddress}).DialContext}}
+
+	errPrivateAddress = errors.New("connection to private address denied")
+)
+
+// Адреса, к которым прокси и опрос трекеров не должны обращаться
+var privateNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10")
+
+func init() {
+	_, err := rand.Read(imageProxyKey)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+func denyPrivateAddress(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errPrivateAddress
+	}
+
+	for _, privateNetwork := range privateNetworks {
+		if privateNetwork.Contains(ip) {
+			return errPrivateAddress
+		}
+	}
+
+	return nil
+}
+
+func imageProxySignature(src string) string {
+	mac := hmac.New(sha256.New, imageProxyKey)
+	mac.Write([]byte(src))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// imageProxyURL возвращает адрес изображения на прокси
+func imageProxyURL(src string) string {
+	return "/image?url=" + url.QueryEscape(src) + "&sig=" + imageProxySignature(src)
+}
+
+func imageProxyHandler(w http.ResponseWriter, r *http.Request) {
+	src := r.FormValue("url")
+
+	if !hmac.Equal([]byte(r.FormValue("sig")), []byte(imageProxySignature(src))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		http.Error(w, "invalid url", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := imageProxyClient.Get(u.String())
+	if err != nil {
+		log.Printf("Image proxy error: %v", err)
+		http.Error(w, "fetch error", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		http.Error(w, "fetch error", http.StatusBadGateway)
+		return
+	}
+
+	// SVG может содержать скрипты
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "image/svg") {
+		http.Error(w, "not an image", http.StatusBadGateway)
+		return
+	}
+
+	if resp.ContentLength > imageProxyMaxSize {
+		http.Error(w, "image is too large", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+
+	io.Copy(w, io.LimitReader(resp.Body, imageProxyMaxSize))
+}
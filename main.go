@@ -6,14 +6,19 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 
 	_ "github.com/nxshock/torrentdb/sources/rutor"
 	_ "github.com/nxshock/torrentdb/sources/rutracker"
 )
 
-func init() {
+// initApp читает конфигурацию и подготавливает выполнение команды.
+// Вызывается из main, а не из init, чтобы тесты пакета не зависели
+// от файла конфигурации и базы данных.
+func initApp() {
 	log.SetFlags(0)
 
 	if len(os.Args) < 2 {
@@ -24,21 +29,37 @@ func init() {
 	// TODO: init config from specified param?
 	err := initConfig(defaultConfigPath)
 	if err != nil {
-		log.Fatalln("Read config error: %v", err)
+		log.Fatalf("Read config error: %v", err)
 	}
 
 	err = initDb()
 	if err != nil {
-		log.Fatalln("Connect database error: %v", err)
+		log.Fatalf("Connect database error: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "daemon", "update", "update-all", "retry-failed", "update-stats", "scrape", "refresh":
+		checkSchemaVersion()
 	}
 
 	switch os.Args[1] {
 	case "daemon":
 		initServer()
+
+		err = initScheduler()
+		if err != nil {
+			log.Fatalf("Init scheduler error: %v", err)
+		}
 	}
 
 	switch os.Args[1] {
-	case "update":
+	case "update", "update-all", "retry-failed", "update-stats", "scrape", "refresh":
+		showProgress = true
+		stopUpdateOnSignal()
+	}
+
+	switch os.Args[1] {
+	case "update", "migrate":
 		if len(os.Args) <= 2 {
 			printUsage()
 			os.Exit(1)
@@ -47,6 +68,8 @@ func init() {
 }
 
 func main() {
+	initApp()
+
 	var err error
 	var exitCode int = 0
 
@@ -61,13 +84,39 @@ func main() {
 		} else {
 			err = update(os.Args[2], "")
 		}
+	case "retry-failed":
+		if len(os.Args) > 2 {
+			err = retryFailed(os.Args[2])
+		} else {
+			retryFailedAll()
+		}
+	case "update-stats":
+		if len(os.Args) > 2 {
+			err = updateStats(os.Args[2])
+		} else {
+			updateStatsAll()
+		}
+	case "scrape":
+		if len(os.Args) > 2 {
+			err = scrapeTrackers(os.Args[2])
+		} else {
+			scrapeTrackersAll()
+		}
+	case "refresh":
+		if len(os.Args) > 2 {
+			err = refresh(os.Args[2])
+		} else {
+			refreshAll()
+		}
+	case "migrate":
+		err = migrate(os.Args[2:])
 	default:
 		err = fmt.Errorf("unknown command: %s", os.Args[1])
 	}
 
 	db.Close()
 
-	if err == errDatabaseIsUpToDate {
+	if err == errDatabaseIsUpToDate || err == errUpdateInterrupted {
 		log.Println(err)
 		exitCode = 0
 	} else if err != nil {
@@ -87,10 +136,23 @@ func printUsage() {
 	log.Printf("%s daemon                            - start http server", binName)
 	log.Printf("%s update [source_name] [torrent_id] - update specified database data", binName)
 	log.Printf("%s update-all                        - update database data", binName)
+	log.Printf("%s retry-failed [source_name]        - retry fetching of failed torrents", binName)
+	log.Printf("%s update-stats [source_name]        - update seeders/leechers of recent torrents", binName)
+	log.Printf("%s scrape [source_name]              - update seeders/leechers of recent torrents from trackers", binName)
+	log.Printf("%s refresh [source_name]             - re-fetch previously loaded torrents to catch changes and removals", binName)
+	log.Printf("%s migrate up [version]              - apply database schema migrations", binName)
+	log.Printf("%s migrate down [version]            - revert database schema migrations", binName)
+	log.Printf("%s migrate status                    - show database schema migrations status", binName)
 }
 
 func wait() { // TODO: нужно имя получше
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	log.Printf("Signal %v received.", <-c)
+
+	log.Println("Stopping http server...")
+	stopServer()
+
+	log.Println("Waiting for running jobs...")
+	scheduler.Stop()
 }
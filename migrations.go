@@ -0,0 +1,567 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Миграция схемы базы данных
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Списки миграций для каждого драйвера, упорядоченные по версии.
+// Уже выпущенные миграции изменять нельзя, только добавлять новые.
+// Номера версий должны совпадать для всех драйверов.
+var postgresMigrations = []migration{
+	{
+		// Таблица info могла быть создана вручную до появления миграций без первичного ключа,
+		// на который ссылаются внешние ключи следующих миграций. В этом случае повторяющиеся
+		// темы удаляются (остаётся одна запись) и ключ добавляется.
+		Version: 1,
+		Name:    "create info table",
+		Up: `
+CREATE TABLE IF NOT EXISTS info (
+	source_id        integer     NOT NULL,
+	topic_id         integer     NOT NULL,
+	title            text        NOT NULL,
+	btih             bytea       NOT NULL,
+	description      text        NOT NULL,
+	publication_time timestamptz NOT NULL,
+	size             bigint      NOT NULL,
+	PRIMARY KEY (source_id, topic_id)
+);
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'info'::regclass AND contype = 'p') THEN
+		DELETE FROM info AS a USING info AS b
+			WHERE a.source_id = b.source_id AND a.topic_id = b.topic_id AND a.ctid < b.ctid;
+		ALTER TABLE info ADD PRIMARY KEY (source_id, topic_id);
+	END IF;
+END
+$$;
+CREATE INDEX IF NOT EXISTS info_btih_idx ON info (btih);
+CREATE INDEX IF NOT EXISTS info_title_idx ON info USING gin (to_tsvector('russian', title));`,
+		Down: `DROP TABLE info;`,
+	},
+	{
+		Version: 2,
+		Name:    "create checkpoint table",
+		Up: `
+CREATE TABLE checkpoint (
+	source_id   integer     PRIMARY KEY,
+	topic_id    integer     NOT NULL,
+	update_time timestamptz NOT NULL
+);`,
+		Down: `DROP TABLE checkpoint;`,
+	},
+	{
+		Version: 3,
+		Name:    "create failed_topic table",
+		Up: `
+CREATE TABLE failed_topic (
+	source_id    integer     NOT NULL,
+	topic_id     integer     NOT NULL,
+	error_class  text        NOT NULL,
+	error        text        NOT NULL,
+	attempts     integer     NOT NULL,
+	last_attempt timestamptz NOT NULL,
+	PRIMARY KEY (source_id, topic_id)
+);`,
+		Down: `DROP TABLE failed_topic;`,
+	},
+	{
+		Version: 4,
+		Name:    "create file table",
+		Up: `
+CREATE TABLE file (
+	source_id integer NOT NULL,
+	topic_id  integer NOT NULL,
+	path      text    NOT NULL,
+	size      bigint  NOT NULL,
+	FOREIGN KEY (source_id, topic_id) REFERENCES info (source_id, topic_id) ON DELETE CASCADE
+);
+CREATE INDEX file_topic_idx ON file (source_id, topic_id);
+CREATE INDEX file_path_idx ON file USING gin (to_tsvector('russian', translate(path, '/._-[]()', '        ')));`,
+		Down: `DROP TABLE file;`,
+	},
+	{
+		Version: 5,
+		Name:    "add info category columns",
+		Up: `
+ALTER TABLE info ADD COLUMN category integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN source_category_id integer NOT NULL DEFAULT 0;
+CREATE INDEX info_category_idx ON info (category);`,
+		Down: `
+DROP INDEX info_category_idx;
+ALTER TABLE info DROP COLUMN source_category_id;
+ALTER TABLE info DROP COLUMN category;`,
+	},
+	{
+		Version: 6,
+		Name:    "add info stats columns",
+		Up: `
+ALTER TABLE info ADD COLUMN seeders integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN leechers integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN completed integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN stats_time timestamptz;`,
+		Down: `
+ALTER TABLE info DROP COLUMN stats_time;
+ALTER TABLE info DROP COLUMN completed;
+ALTER TABLE info DROP COLUMN leechers;
+ALTER TABLE info DROP COLUMN seeders;`,
+	},
+	{
+		Version: 7,
+		Name:    "create tracker table and info tracker stats columns",
+		Up: `
+CREATE TABLE tracker (
+	source_id   integer     NOT NULL,
+	topic_id    integer     NOT NULL,
+	url         text        NOT NULL,
+	seeders     integer     NOT NULL DEFAULT 0,
+	leechers    integer     NOT NULL DEFAULT 0,
+	completed   integer     NOT NULL DEFAULT 0,
+	scrape_time timestamptz,
+	PRIMARY KEY (source_id, topic_id, url),
+	FOREIGN KEY (source_id, topic_id) REFERENCES info (source_id, topic_id) ON DELETE CASCADE
+);
+ALTER TABLE info ADD COLUMN tracker_seeders integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN tracker_leechers integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN tracker_completed integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN tracker_stats_time timestamptz;`,
+		Down: `
+ALTER TABLE info DROP COLUMN tracker_stats_time;
+ALTER TABLE info DROP COLUMN tracker_completed;
+ALTER TABLE info DROP COLUMN tracker_leechers;
+ALTER TABLE info DROP COLUMN tracker_seeders;
+DROP TABLE tracker;`,
+	},
+	{
+		Version: 8,
+		Name:    "create info_history table",
+		Up: `
+ALTER TABLE info ADD COLUMN change_time timestamptz;
+CREATE TABLE info_history (
+	source_id    integer     NOT NULL,
+	topic_id     integer     NOT NULL,
+	title        text        NOT NULL,
+	btih         bytea       NOT NULL,
+	size         bigint      NOT NULL,
+	replace_time timestamptz NOT NULL,
+	FOREIGN KEY (source_id, topic_id) REFERENCES info (source_id, topic_id) ON DELETE CASCADE
+);
+CREATE INDEX info_history_topic_idx ON info_history (source_id, topic_id);`,
+		Down: `
+DROP TABLE info_history;
+ALTER TABLE info DROP COLUMN change_time;`,
+	},
+	{
+		Version: 9,
+		Name:    "add refresh and remove time",
+		Up: `
+ALTER TABLE info ADD COLUMN refresh_time timestamptz;
+ALTER TABLE info ADD COLUMN remove_time timestamptz;
+CREATE INDEX info_publication_time_idx ON info (source_id, publication_time);`,
+		Down: `
+DROP INDEX info_publication_time_idx;
+ALTER TABLE info DROP COLUMN remove_time;
+ALTER TABLE info DROP COLUMN refresh_time;`,
+	},
+}
+
+var sqliteMigrations = []migration{
+	{
+		// Базы SQLite создаются только миграциями, поэтому уже существующая
+		// таблица info считается ошибкой
+		Version: 1,
+		Name:    "create info table",
+		Up: `
+CREATE TABLE info (
+	source_id        integer   NOT NULL,
+	topic_id         integer   NOT NULL,
+	title            text      NOT NULL,
+	btih             blob      NOT NULL,
+	description      text      NOT NULL,
+	publication_time timestamp NOT NULL,
+	size             integer   NOT NULL,
+	PRIMARY KEY (source_id, topic_id)
+);
+CREATE INDEX info_btih_idx ON info (btih);
+CREATE VIRTUAL TABLE info_fts USING fts5(title, content='info', content_rowid='rowid');
+CREATE TRIGGER info_ai AFTER INSERT ON info BEGIN
+	INSERT INTO info_fts (rowid, title) VALUES (new.rowid, new.title);
+END;
+CREATE TRIGGER info_ad AFTER DELETE ON info BEGIN
+	INSERT INTO info_fts (info_fts, rowid, title) VALUES ('delete', old.rowid, old.title);
+END;
+CREATE TRIGGER info_au AFTER UPDATE OF title ON info BEGIN
+	INSERT INTO info_fts (info_fts, rowid, title) VALUES ('delete', old.rowid, old.title);
+	INSERT INTO info_fts (rowid, title) VALUES (new.rowid, new.title);
+END;`,
+		Down: `
+DROP TRIGGER info_au;
+DROP TRIGGER info_ad;
+DROP TRIGGER info_ai;
+DROP TABLE info_fts;
+DROP TABLE info;`,
+	},
+	{
+		Version: 2,
+		Name:    "create checkpoint table",
+		Up: `
+CREATE TABLE checkpoint (
+	source_id   integer   PRIMARY KEY,
+	topic_id    integer   NOT NULL,
+	update_time timestamp NOT NULL
+);`,
+		Down: `DROP TABLE checkpoint;`,
+	},
+	{
+		Version: 3,
+		Name:    "create failed_topic table",
+		Up: `
+CREATE TABLE failed_topic (
+	source_id    integer   NOT NULL,
+	topic_id     integer   NOT NULL,
+	error_class  text      NOT NULL,
+	error        text      NOT NULL,
+	attempts     integer   NOT NULL,
+	last_attempt timestamp NOT NULL,
+	PRIMARY KEY (source_id, topic_id)
+);`,
+		Down: `DROP TABLE failed_topic;`,
+	},
+	{
+		Version: 4,
+		Name:    "create file table",
+		Up: `
+CREATE TABLE file (
+	source_id integer NOT NULL,
+	topic_id  integer NOT NULL,
+	path      text    NOT NULL,
+	size      integer NOT NULL,
+	FOREIGN KEY (source_id, topic_id) REFERENCES info (source_id, topic_id) ON DELETE CASCADE
+);
+CREATE INDEX file_topic_idx ON file (source_id, topic_id);
+CREATE VIRTUAL TABLE file_fts USING fts5(path, content='file', content_rowid='rowid');
+CREATE TRIGGER file_ai AFTER INSERT ON file BEGIN
+	INSERT INTO file_fts (rowid, path) VALUES (new.rowid, new.path);
+END;
+CREATE TRIGGER file_ad AFTER DELETE ON file BEGIN
+	INSERT INTO file_fts (file_fts, rowid, path) VALUES ('delete', old.rowid, old.path);
+END;
+CREATE TRIGGER file_au AFTER UPDATE OF path ON file BEGIN
+	INSERT INTO file_fts (file_fts, rowid, path) VALUES ('delete', old.rowid, old.path);
+	INSERT INTO file_fts (rowid, path) VALUES (new.rowid, new.path);
+END;`,
+		Down: `
+DROP TRIGGER file_au;
+DROP TRIGGER file_ad;
+DROP TRIGGER file_ai;
+DROP TABLE file_fts;
+DROP TABLE file;`,
+	},
+	{
+		Version: 5,
+		Name:    "add info category columns",
+		Up: `
+ALTER TABLE info ADD COLUMN category integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN source_category_id integer NOT NULL DEFAULT 0;
+CREATE INDEX info_category_idx ON info (category);`,
+		Down: `
+DROP INDEX info_category_idx;
+ALTER TABLE info DROP COLUMN source_category_id;
+ALTER TABLE info DROP COLUMN category;`,
+	},
+	{
+		Version: 6,
+		Name:    "add info stats columns",
+		Up: `
+ALTER TABLE info ADD COLUMN seeders integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN leechers integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN completed integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN stats_time timestamp;`,
+		Down: `
+ALTER TABLE info DROP COLUMN stats_time;
+ALTER TABLE info DROP COLUMN completed;
+ALTER TABLE info DROP COLUMN leechers;
+ALTER TABLE info DROP COLUMN seeders;`,
+	},
+	{
+		Version: 7,
+		Name:    "create tracker table and info tracker stats columns",
+		Up: `
+CREATE TABLE tracker (
+	source_id   integer   NOT NULL,
+	topic_id    integer   NOT NULL,
+	url         text      NOT NULL,
+	seeders     integer   NOT NULL DEFAULT 0,
+	leechers    integer   NOT NULL DEFAULT 0,
+	completed   integer   NOT NULL DEFAULT 0,
+	scrape_time timestamp,
+	PRIMARY KEY (source_id, topic_id, url),
+	FOREIGN KEY (source_id, topic_id) REFERENCES info (source_id, topic_id) ON DELETE CASCADE
+);
+ALTER TABLE info ADD COLUMN tracker_seeders integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN tracker_leechers integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN tracker_completed integer NOT NULL DEFAULT 0;
+ALTER TABLE info ADD COLUMN tracker_stats_time timestamp;`,
+		Down: `
+ALTER TABLE info DROP COLUMN tracker_stats_time;
+ALTER TABLE info DROP COLUMN tracker_completed;
+ALTER TABLE info DROP COLUMN tracker_leechers;
+ALTER TABLE info DROP COLUMN tracker_seeders;
+DROP TABLE tracker;`,
+	},
+	{
+		Version: 8,
+		Name:    "create info_history table",
+		Up: `
+ALTER TABLE info ADD COLUMN change_time timestamp;
+CREATE TABLE info_history (
+	source_id    integer   NOT NULL,
+	topic_id     integer   NOT NULL,
+	title        text      NOT NULL,
+	btih         blob      NOT NULL,
+	size         integer   NOT NULL,
+	replace_time timestamp NOT NULL,
+	FOREIGN KEY (source_id, topic_id) REFERENCES info (source_id, topic_id) ON DELETE CASCADE
+);
+CREATE INDEX info_history_topic_idx ON info_history (source_id, topic_id);`,
+		Down: `
+DROP TABLE info_history;
+ALTER TABLE info DROP COLUMN change_time;`,
+	},
+	{
+		Version: 9,
+		Name:    "add refresh and remove time",
+		Up: `
+ALTER TABLE info ADD COLUMN refresh_time timestamp;
+ALTER TABLE info ADD COLUMN remove_time timestamp;
+CREATE INDEX info_publication_time_idx ON info (source_id, publication_time);`,
+		Down: `
+DROP INDEX info_publication_time_idx;
+ALTER TABLE info DROP COLUMN remove_time;
+ALTER TABLE info DROP COLUMN refresh_time;`,
+	},
+}
+
+var errUnknownMigrateCommand = errors.New("unknown migrate command, expected up, down or status")
+
+func (database *Database) Migrations() []migration {
+	return database.migrations
+}
+
+func (database *Database) LatestSchemaVersion() int {
+	if len(database.migrations) == 0 {
+		return 0
+	}
+
+	return database.migrations[len(database.migrations)-1].Version
+}
+
+func (database *Database) initSchemaVersionTable() error {
+	_, err := database.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+	version    integer   PRIMARY KEY,
+	name       text      NOT NULL,
+	applied_at timestamp NOT NULL
+)`)
+
+	return err
+}
+
+// SchemaVersion возвращает номер последней применённой миграции
+func (database *Database) SchemaVersion() (int, error) {
+	err := database.initSchemaVersionTable()
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = database.db.QueryRow("SELECT COALESCE(max(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// MigrateUp применяет все миграции с версией не выше targetVersion
+func (database *Database) MigrateUp(targetVersion int) error {
+	currentVersion, err := database.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range database.migrations {
+		if m.Version <= currentVersion || m.Version > targetVersion {
+			continue
+		}
+
+		log.Printf("Applying migration %d (%s)...", m.Version, m.Name)
+
+		err = database.applyMigration(m.Up, "INSERT INTO schema_version (version, name, applied_at) VALUES ($1, $2, $3)", m.Version, m.Name, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("migration %d: %v", m.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown откатывает все миграции с версией выше targetVersion
+func (database *Database) MigrateDown(targetVersion int) error {
+	currentVersion, err := database.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for i := len(database.migrations) - 1; i >= 0; i-- {
+		m := database.migrations[i]
+		if m.Version > currentVersion || m.Version <= targetVersion {
+			continue
+		}
+
+		log.Printf("Reverting migration %d (%s)...", m.Version, m.Name)
+
+		err = database.applyMigration(m.Down, "DELETE FROM schema_version WHERE version = $1", m.Version)
+		if err != nil {
+			return fmt.Errorf("migration %d: %v", m.Version, err)
+		}
+	}
+
+	return nil
+}
+
+func (database *Database) applyMigration(script string, versionSQL string, versionArgs ...interface{}) error {
+	tx, err := database.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(script)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(versionSQL, versionArgs...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (database *Database) AppliedMigrations() (map[int]time.Time, error) {
+	err := database.initSchemaVersionTable()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.db.Query("SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func migrate(args []string) error {
+	switch args[0] {
+	case "up":
+		targetVersion := db.LatestSchemaVersion()
+		if len(args) > 1 {
+			var err error
+			targetVersion, err = strconv.Atoi(args[1])
+			if err != nil {
+				return err
+			}
+		}
+
+		err := db.MigrateUp(targetVersion)
+		if err != nil {
+			return err
+		}
+	case "down":
+		currentVersion, err := db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+
+		targetVersion := currentVersion - 1
+		if len(args) > 1 {
+			targetVersion, err = strconv.Atoi(args[1])
+			if err != nil {
+				return err
+			}
+		}
+
+		err = db.MigrateDown(targetVersion)
+		if err != nil {
+			return err
+		}
+	case "status":
+		applied, err := db.AppliedMigrations()
+		if err != nil {
+			return err
+		}
+
+		for _, m := range db.Migrations() {
+			if appliedAt, ok := applied[m.Version]; ok {
+				log.Printf("%4d %-40s applied at %s", m.Version, m.Name, appliedAt.Format(time.RFC3339))
+			} else {
+				log.Printf("%4d %-40s pending", m.Version, m.Name)
+			}
+		}
+	default:
+		return errUnknownMigrateCommand
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Schema version: %d (latest: %d).", version, db.LatestSchemaVersion())
+
+	return nil
+}
+
+func checkSchemaVersion() {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		log.Printf("Check schema version error: %v", err)
+		return
+	}
+
+	if version < db.LatestSchemaVersion() {
+		log.Printf("Database schema is outdated (version %d, latest %d), run `%s migrate up`.", version, db.LatestSchemaVersion(), filepath.Base(os.Args[0]))
+	}
+}
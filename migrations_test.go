@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrationVersions(t *testing.T) {
+	assert.Equal(t, len(postgresMigrations), len(sqliteMigrations))
+
+	for i := range postgresMigrations {
+		assert.Equal(t, i+1, postgresMigrations[i].Version)
+		assert.Equal(t, postgresMigrations[i].Version, sqliteMigrations[i].Version)
+		assert.Equal(t, postgresMigrations[i].Name, sqliteMigrations[i].Name)
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	newTestDb(t)
+
+	latest := db.LatestSchemaVersion()
+
+	version, err := db.SchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	applied, err := db.AppliedMigrations()
+	assert.NoError(t, err)
+	assert.Len(t, applied, latest)
+
+	// Повторное применение не изменяет схему
+	assert.NoError(t, db.MigrateUp(latest))
+
+	// Все миграции откатываются и применяются заново
+	for target := latest - 1; target >= 0; target-- {
+		assert.NoError(t, db.MigrateDown(target), "down to %d", target)
+
+		version, err = db.SchemaVersion()
+		assert.NoError(t, err)
+		assert.Equal(t, target, version)
+	}
+
+	applied, err = db.AppliedMigrations()
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	assert.NoError(t, db.MigrateUp(latest))
+
+	version, err = db.SchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	insertTestTorrent(t, 1, 1, "Movie", 1, 0)
+}
+
+func TestMigrateCommand(t *testing.T) {
+	newTestDb(t)
+
+	latest := db.LatestSchemaVersion()
+
+	assert.NoError(t, migrate([]string{"down"}))
+	version, err := db.SchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, latest-1, version)
+
+	assert.NoError(t, migrate([]string{"status"}))
+
+	assert.NoError(t, migrate([]string{"down", "2"}))
+	version, err = db.SchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	assert.NoError(t, migrate([]string{"up"}))
+	version, err = db.SchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	assert.Error(t, migrate([]string{"up", "x"}))
+	assert.Equal(t, errUnknownMigrateCommand, migrate([]string{"sideways"}))
+}
+
+func TestMigrateExistingInfoTable(t *testing.T) {
+	newTestDb(t)
+	assert.NoError(t, db.MigrateDown(0))
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	_, err = tx.Exec("CREATE TABLE info (source_id integer, topic_id integer, title text)")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+
+	err = db.MigrateUp(db.LatestSchemaVersion())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "table info already exists")
+	}
+
+	version, err := db.SchemaVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+}
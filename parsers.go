@@ -1,43 +1,90 @@
 package main
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
 	"sync"
+	"syscall"
 
 	"github.com/nxshock/torrentdb/sources"
+	"github.com/nxshock/torrentdb/torrent"
 )
 
-var errDatabaseIsUpToDate = errors.New("database is up to date")
+var (
+	errDatabaseIsUpToDate = errors.New("database is up to date")
+	errUpdateInterrupted  = errors.New("update interrupted, progress saved")
+)
+
+var (
+	// Закрывается для остановки текущего обновления
+	stopUpdate = make(chan struct{})
+
+	// Выводить прогресс обновления в stderr
+	showProgress bool
+)
 
-func parserThread(transaction *sql.Tx, source sources.Source, c chan int, wg *sync.WaitGroup, errChan chan error) {
+// Результат обработки одного ID
+type parseResult struct {
+	id      int
+	torrent *torrent.Torrent
+	err     error
+}
+
+func parserThread(source sources.Source, c chan int, wg *sync.WaitGroup, results chan parseResult) {
 	defer wg.Done()
 
 	for id := range c {
 		torrent, err := source.GetTorrentByID(id)
-		if err != nil {
-			errChan <- err
-			continue
-		}
-		err = db.InsertTorrentWithTx(transaction, source.ID(), id, torrent)
-		if err != nil {
-			errChan <- err
-			continue
+		results <- parseResult{id, torrent, err}
+	}
+}
+
+// stopUpdateOnSignal прерывает обновление при получении SIGINT или SIGTERM
+func stopUpdateOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		log.Printf("Signal %v received, stopping update...", <-c)
+		close(stopUpdate)
+	}()
+}
+
+// openSource открывает источник с параметрами из конфигурации
+func openSource(driverName string) (sources.Source, error) {
+	sourceConfig := config.Source(driverName)
+	if sourceConfig == nil {
+		return nil, fmt.Errorf("unknown source %q", driverName)
+	}
+
+	return sources.Open(driverName, sourceConfig.Options)
+}
+
+// enabledSources возвращает имена источников, не отключённых в конфигурации
+func enabledSources() []string {
+	var driverNames []string
+	for _, driverName := range sources.RegisteredDrivers() {
+		if sourceConfig := config.Source(driverName); sourceConfig != nil && sourceConfig.Enabled {
+			driverNames = append(driverNames, driverName)
 		}
-		errChan <- nil
 	}
+
+	return driverNames
 }
 
 func updateAll() {
-	drivers := sources.RegisteredDrivers()
+	drivers := enabledSources()
 	for _, driverName := range drivers {
 		err := update(driverName, "")
 		if err == errDatabaseIsUpToDate {
 			log.Printf("%s: %v", driverName, err)
+		} else if err == errUpdateInterrupted {
+			log.Printf("%s: %v", driverName, err)
+			return
 		} else if err != nil {
 			log.Printf("Update %s torrent data error: %v", driverName, err)
 		}
@@ -45,7 +92,7 @@ func updateAll() {
 }
 
 func update(driverName string, torrentNum string) error {
-	source, err := sources.Open(driverName, config.Main.ProxyAddr)
+	source, err := openSource(driverName)
 	if err != nil {
 		return err
 	}
@@ -57,7 +104,12 @@ func update(driverName string, torrentNum string) error {
 		}
 
 		torrent, err := source.GetTorrentByID(id)
-		if err != nil {
+		if isMissing(err) {
+			return err
+		} else if err != nil {
+			if recordErr := db.RecordFailure(source.ID(), id, err); recordErr != nil {
+				log.Printf("Record failure error: %v", recordErr)
+			}
 			return err
 		}
 		err = db.InsertTorrent(source.ID(), id, torrent)
@@ -65,13 +117,20 @@ func update(driverName string, torrentNum string) error {
 			return err
 		}
 
-		return nil
+		return db.DeleteFailure(source.ID(), id)
 	}
 
 	maxDbTorrentID, err := db.GetMaxTorrentID(source.ID())
 	if err != nil {
 		return err
 	}
+	checkpoint, err := db.GetCheckpoint(source.ID())
+	if err != nil {
+		return err
+	}
+	if checkpoint > maxDbTorrentID {
+		maxDbTorrentID = checkpoint
+	}
 	maxSourceTorrentID, err := source.MaxTorrentID()
 	if err != nil {
 		return err
@@ -83,51 +142,200 @@ func update(driverName string, torrentNum string) error {
 
 	log.Printf("Обновление данных %s с %d по %d", driverName, maxDbTorrentID+1, maxSourceTorrentID)
 
+	threadCount := config.Source(driverName).UpdateThreadCount
+
+	err = fetchTorrents(source, threadCount, idRange(maxDbTorrentID+1, maxSourceTorrentID), func(results chan parseResult) error {
+		return saveResults(source, maxDbTorrentID+1, maxSourceTorrentID, results)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Update of %s completed.", driverName)
+
+	return nil
+}
+
+// fetchTorrents загружает торренты с ID, перечисляемыми ids, в threadCount потоков
+// и передаёт канал результатов в save. Перечисление прекращается при остановке
+// обновления или ошибке save, в обоих случаях функция дожидается завершения потоков.
+func fetchTorrents(source sources.Source, threadCount int, ids func(send func(id int) bool), save func(results chan parseResult) error) error {
 	c := make(chan int)
 
 	wg := new(sync.WaitGroup)
-	wg.Add(config.Main.UpdateThreadCount)
+	wg.Add(threadCount)
+
+	results := make(chan parseResult)
+
+	for i := 0; i < threadCount; i++ {
+		go parserThread(source, c, wg, results)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(c)
+
+		ids(func(id int) bool {
+			select {
+			case c <- id:
+				return true
+			case <-stopUpdate:
+				return false
+			case <-done:
+				return false
+			}
+		})
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	err := save(results)
+
+	// Ожидание завершения потоков в случае ошибки сохранения
+	close(done)
+	for range results {
+	}
 
-	tx, err := db.db.Begin()
 	if err != nil {
 		return err
 	}
 
-	errCounter := make(chan error)
+	select {
+	case <-stopUpdate:
+		return errUpdateInterrupted
+	default:
+	}
+
+	return nil
+}
 
-	for i := 0; i < config.Main.UpdateThreadCount; i++ {
-		go parserThread(tx, source, c, wg, errCounter)
+// idRange перечисляет ID от fromID до toID включительно
+func idRange(fromID, toID int) func(send func(id int) bool) {
+	return func(send func(id int) bool) {
+		for id := fromID; id <= toID; id++ {
+			if !send(id) {
+				return
+			}
+		}
 	}
+}
 
-	go func() {
-		for i := maxDbTorrentID + 1; i <= maxSourceTorrentID; i++ {
-			c <- i
+// idList перечисляет ID из списка
+func idList(ids []int) func(send func(id int) bool) {
+	return func(send func(id int) bool) {
+		for _, id := range ids {
+			if !send(id) {
+				return
+			}
 		}
-		close(c)
-		wg.Wait()
-		close(errCounter)
-	}()
+	}
+}
 
+// saveResults сохраняет результаты в порядке возрастания ID пакетами по
+// config.Main.UpdateBatchSize записей, фиксируя вместе с каждым пакетом
+// контрольную точку - последний обработанный ID, включая ошибочные.
+// Отсутствующие на источнике ID пропускаются, остальные ошибки записываются
+// для повторных попыток. Пакет накапливается в памяти, транзакция открывается
+// только на время его записи и не удерживается, пока потоки загружают торренты.
+func saveResults(source sources.Source, fromID, toID int, results chan parseResult) error {
 	var (
+		pending = make(map[int]parseResult)
+		batch   []parseResult
+		nextID  = fromID
+
 		newTorrentsCount int
+		missingCount     int
 		errorCount       int
+		errorClasses     = make(errorCounts)
 	)
-	for err := range errCounter {
-		if err != nil {
-			errorCount++
-		} else {
-			newTorrentsCount++
+
+	for result := range results {
+		pending[result.id] = result
+
+		for {
+			result, exists := pending[nextID]
+			if !exists {
+				break
+			}
+			delete(pending, nextID)
+
+			if isMissing(result.err) {
+				errorClasses.Add(result.err)
+				missingCount++
+			} else if result.err != nil {
+				errorClasses.Add(result.err)
+				errorCount++
+			} else {
+				newTorrentsCount++
+			}
+
+			batch = append(batch, result)
+			nextID++
+		}
+
+		if len(batch) >= config.Main.UpdateBatchSize {
+			err := saveBatch(source.ID(), batch)
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+
+		if showProgress {
+			fmt.Fprintf(os.Stderr, "\rProcessed %d / %d (new torrents: %d, missing: %d, errors: %d)...", newTorrentsCount+missingCount+errorCount, toID-fromID+1, newTorrentsCount, missingCount, errorCount)
 		}
-		fmt.Fprintf(os.Stderr, "\rProcessed %d / %d (new torrents: %d, errors: %d)...", errorCount+newTorrentsCount, maxSourceTorrentID-maxDbTorrentID, newTorrentsCount, errorCount)
 	}
-	fmt.Fprintf(os.Stderr, "\n")
+	if showProgress {
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+
+	log.Printf("Processed %d (new torrents: %d, missing: %d, errors: %d).", newTorrentsCount+missingCount+errorCount, newTorrentsCount, missingCount, errorCount)
+	if len(errorClasses) > 0 {
+		log.Printf("Errors by class: %v.", errorClasses)
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
 
-	err = tx.Commit()
+	return saveBatch(source.ID(), batch)
+}
+
+// saveBatch записывает упорядоченный по ID пакет результатов в одной транзакции
+// и сохраняет ID последнего из них как контрольную точку
+func saveBatch(sourceID int, batch []parseResult) error {
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Update of %s completed.", driverName)
+	for _, result := range batch {
+		if isMissing(result.err) {
+			continue
+		} else if result.err != nil {
+			err = db.RecordFailureWithTx(tx, sourceID, result.id, result.err)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("record failure %d: %v", result.id, err)
+			}
+		} else {
+			err = db.InsertTorrentWithTx(tx, sourceID, result.id, result.torrent)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("save torrent %d: %v", result.id, err)
+			}
+		}
+	}
 
-	return nil
+	err = db.SetCheckpointWithTx(tx, sourceID, batch[len(batch)-1].id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
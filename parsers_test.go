@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/sources"
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+// ID тестового источника, не совпадающий с ID настоящих источников
+const testSourceID = 100
+
+// Тестовый источник, отдающий торренты с ID до maxID, кроме перечисленных в errs
+type testSource struct {
+	maxID int
+	errs  map[int]error
+}
+
+func (source *testSource) ID() int                    { return testSourceID }
+func (source *testSource) Name() string               { return "Test" }
+func (source *testSource) TopicURL(id int) string     { return fmt.Sprintf("http://test/%d", id) }
+func (source *testSource) MaxTorrentID() (int, error) { return source.maxID, nil }
+
+func (source *testSource) GetTorrentByID(id int) (*torrent.Torrent, error) {
+	if err := source.errs[id]; err != nil {
+		return nil, err
+	}
+
+	return newTestTorrent(id), nil
+}
+
+func newTestTorrent(id int) *torrent.Torrent {
+	return &torrent.Torrent{
+		Title:           fmt.Sprintf("Movie %d", id),
+		Btih:            []byte{byte(id)},
+		PublicationTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Size:            uint64(id)}
+}
+
+// Источник, возвращаемый драйвером "test", и ошибка открытия источника
+var (
+	currentTestSource = new(testSource)
+	testDriverErr     error
+)
+
+type testDriver struct{}
+
+func (testDriver) NewOptions() sources.DriverOptions { return new(sources.Options) }
+
+func (testDriver) Open(options sources.DriverOptions) (sources.Source, error) {
+	if testDriverErr != nil {
+		return nil, testDriverErr
+	}
+
+	return currentTestSource, nil
+}
+
+func init() {
+	sources.Register("test", testDriver{})
+}
+
+// topicIDs возвращает ID сохранённых тем тестового источника среди ID от 1 до 10
+func topicIDs(t *testing.T) []int {
+	t.Helper()
+
+	var ids []int
+	for id := 1; id <= 10; id++ {
+		listings, err := db.GetListings(newTestTorrent(id).Btih)
+		assert.NoError(t, err)
+
+		for _, listing := range listings {
+			if listing.SourceID == testSourceID {
+				ids = append(ids, listing.TopicID)
+			}
+		}
+	}
+
+	return ids
+}
+
+func TestSaveResultsOrder(t *testing.T) {
+	newTestDb(t)
+	config.Main.UpdateBatchSize = 2
+
+	transientErr := fmt.Errorf("%w: 503", sources.ErrTransient)
+
+	// Результаты потоков приходят не по порядку
+	results := make(chan parseResult, 5)
+	results <- parseResult{3, newTestTorrent(3), nil}
+	results <- parseResult{1, newTestTorrent(1), nil}
+	results <- parseResult{2, nil, transientErr}
+	results <- parseResult{5, newTestTorrent(5), nil}
+	results <- parseResult{4, nil, sources.ErrNotFound}
+	close(results)
+
+	err := saveResults(currentTestSource, 1, 5, results)
+	assert.NoError(t, err)
+
+	checkpoint, err := db.GetCheckpoint(testSourceID)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, checkpoint)
+
+	assert.Equal(t, []int{1, 3, 5}, topicIDs(t))
+
+	// Отсутствующие на источнике ID не записываются как ошибки
+	failedTopics, err := db.GetFailedTopics(testSourceID)
+	assert.NoError(t, err)
+	if assert.Len(t, failedTopics, 1) {
+		assert.Equal(t, 2, failedTopics[0].TopicID)
+		assert.Equal(t, ErrorClassTransient, failedTopics[0].ErrorClass)
+	}
+}
+
+func TestSaveResultsGap(t *testing.T) {
+	newTestDb(t)
+	config.Main.UpdateBatchSize = 1
+
+	// Обновление прервано до получения ID 6: контрольная точка
+	// не должна перейти через необработанный ID
+	results := make(chan parseResult, 2)
+	results <- parseResult{7, newTestTorrent(7), nil}
+	results <- parseResult{8, newTestTorrent(8), nil}
+	close(results)
+
+	err := saveResults(currentTestSource, 6, 8, results)
+	assert.NoError(t, err)
+
+	checkpoint, err := db.GetCheckpoint(testSourceID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, checkpoint)
+	assert.Empty(t, topicIDs(t))
+}
+
+func TestSaveResultsNoLongTransaction(t *testing.T) {
+	newTestDb(t)
+	config.Main.UpdateBatchSize = 10
+
+	results := make(chan parseResult)
+	saved := make(chan error, 1)
+	go func() { saved <- saveResults(currentTestSource, 1, 3, results) }()
+
+	// После приёма второго результата первый уже обработан
+	results <- parseResult{1, newTestTorrent(1), nil}
+	results <- parseResult{2, newTestTorrent(2), nil}
+
+	// Пока пакет не заполнен, запись в базу другими не блокируется
+	inserted := make(chan error, 1)
+	go func() { inserted <- db.InsertTorrent(testSourceID+1, 1, newTestTorrent(9)) }()
+
+	select {
+	case err := <-inserted:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("insert is blocked by saveResults transaction")
+	}
+
+	results <- parseResult{3, newTestTorrent(3), nil}
+	close(results)
+	assert.NoError(t, <-saved)
+
+	assert.Equal(t, []int{1, 2, 3}, topicIDs(t))
+
+	checkpoint, err := db.GetCheckpoint(testSourceID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, checkpoint)
+}
+
+func TestUpdate(t *testing.T) {
+	newTestDb(t)
+
+	currentTestSource = &testSource{
+		maxID: 8,
+		errs: map[int]error{
+			2: sources.ErrDeleted,
+			6: errors.New("unknown error")}}
+	defer func() { currentTestSource = new(testSource) }()
+
+	err := update("test", "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []int{1, 3, 4, 5, 7, 8}, topicIDs(t))
+
+	checkpoint, err := db.GetCheckpoint(testSourceID)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, checkpoint)
+
+	err = update("test", "")
+	assert.Equal(t, errDatabaseIsUpToDate, err)
+
+	// Загрузка одного торрента удаляет его из списка ошибок
+	delete(currentTestSource.errs, 6)
+
+	err = update("test", "6")
+	assert.NoError(t, err)
+
+	failedTopics, err := db.GetFailedTopics(testSourceID)
+	assert.NoError(t, err)
+	assert.Empty(t, failedTopics)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Интервалы повторной проверки торрентов в зависимости от возраста:
+// новые темы изменяются чаще, поэтому проверяются чаще и в первую очередь
+var refreshIntervals = []struct {
+	maxAge   time.Duration // 0 - без ограничения
+	interval time.Duration
+}{
+	{7 * 24 * time.Hour, 24 * time.Hour},
+	{30 * 24 * time.Hour, 7 * 24 * time.Hour},
+	{365 * 24 * time.Hour, 30 * 24 * time.Hour},
+	{0, 180 * 24 * time.Hour}}
+
+func refreshAll() {
+	drivers := enabledSources()
+	for _, driverName := range drivers {
+		err := refresh(driverName)
+		if err == errUpdateInterrupted {
+			log.Printf("%s: %v", driverName, err)
+			return
+		} else if err != nil {
+			log.Printf("Refresh %s torrents error: %v", driverName, err)
+		}
+	}
+}
+
+// refresh повторно загружает не более RefreshLimit ранее загруженных торрентов,
+// срок проверки которых истёк. Изменённые торренты обновляются, отсутствующие
+// на источнике отмечаются удалёнными, но остаются в базе.
+func refresh(driverName string) error {
+	source, err := openSource(driverName)
+	if err != nil {
+		return err
+	}
+
+	ids, err := refreshTopicIDs(source.ID(), config.Main.RefreshLimit)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Повторная проверка %d торрентов %s", len(ids), driverName)
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var (
+		updatedCount int
+		removedCount int
+		errorCount   int
+		errorClasses = make(errorCounts)
+	)
+
+	threadCount := config.Source(driverName).UpdateThreadCount
+
+	err = fetchTorrents(source, threadCount, idList(ids), func(results chan parseResult) error {
+		for result := range results {
+			err := saveRefreshResult(source.ID(), result)
+			if err != nil {
+				return err
+			}
+
+			if result.err == nil {
+				updatedCount++
+			} else if isMissing(result.err) {
+				errorClasses.Add(result.err)
+				removedCount++
+			} else {
+				errorClasses.Add(result.err)
+				errorCount++
+				log.Printf("Refresh %s torrent %d error: %v", driverName, result.id, result.err)
+			}
+
+			if showProgress {
+				fmt.Fprintf(os.Stderr, "\rProcessed %d / %d (removed: %d, errors: %d)...", updatedCount+removedCount+errorCount, len(ids), removedCount, errorCount)
+			}
+		}
+		if showProgress {
+			fmt.Fprintf(os.Stderr, "\n")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(errorClasses) > 0 {
+		log.Printf("Errors by class: %v.", errorClasses)
+	}
+
+	log.Printf("Refresh of %s completed (updated: %d, removed: %d, errors: %d).", driverName, updatedCount, removedCount, errorCount)
+
+	return nil
+}
+
+// refreshTopicIDs возвращает ID торрентов, срок проверки которых истёк,
+// начиная с самых новых
+func refreshTopicIDs(sourceID int, limit int) ([]int, error) {
+	now := time.Now()
+	to := now
+
+	var ids []int
+	for _, v := range refreshIntervals {
+		if len(ids) >= limit {
+			break
+		}
+
+		var from time.Time
+		if v.maxAge > 0 {
+			from = now.Add(-v.maxAge)
+		}
+
+		intervalIDs, err := db.GetRefreshTopicIDs(sourceID, from, to, now.Add(-v.interval), limit-len(ids))
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, intervalIDs...)
+
+		to = from
+	}
+
+	return ids, nil
+}
+
+// saveRefreshResult сохраняет результат проверки торрента. Время проверки
+// обновляется и при ошибке, чтобы недоступные темы не занимали очередь.
+func saveRefreshResult(sourceID int, result parseResult) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if result.err == nil {
+		err = db.InsertTorrentWithTx(tx, sourceID, result.id, result.torrent)
+	} else if isMissing(result.err) {
+		err = db.MarkRemovedWithTx(tx, sourceID, result.id, now)
+	} else {
+		err = db.SetRefreshTimeWithTx(tx, sourceID, result.id, now)
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("save torrent %d: %v", result.id, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/sources"
+)
+
+// insertRefreshTestTorrent добавляет торрент заданного возраста,
+// проверявшийся refreshAge назад
+func insertRefreshTestTorrent(t *testing.T, topicID int, age, refreshAge time.Duration) {
+	t.Helper()
+
+	now := time.Now()
+
+	torrent := newTestTorrent(topicID)
+	torrent.PublicationTime = now.Add(-age)
+
+	err := db.InsertTorrent(testSourceID, topicID, torrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setTestRefreshTime(t, topicID, now.Add(-refreshAge))
+}
+
+func setTestRefreshTime(t *testing.T, topicID int, refreshTime time.Time) {
+	t.Helper()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SetRefreshTimeWithTx(tx, testSourceID, topicID, refreshTime)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshTopicIDs(t *testing.T) {
+	newTestDb(t)
+
+	const day = 24 * time.Hour
+
+	insertRefreshTestTorrent(t, 1, 1*day, 2*day)        // неделя, проверка раз в день - пора
+	insertRefreshTestTorrent(t, 2, 2*day, 12*time.Hour) // проверен недавно
+	insertRefreshTestTorrent(t, 3, 10*day, 3*day)       // месяц, проверка раз в неделю - рано
+	insertRefreshTestTorrent(t, 4, 20*day, 8*day)       // пора
+	insertRefreshTestTorrent(t, 5, 100*day, 31*day)     // год, проверка раз в месяц - пора
+	insertRefreshTestTorrent(t, 6, 400*day, 100*day)    // старше года, проверка раз в полгода - рано
+	insertRefreshTestTorrent(t, 7, 500*day, 200*day)    // пора
+	insertRefreshTestTorrent(t, 8, 3*day, 2*day)        // удалён на источнике
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, db.MarkRemovedWithTx(tx, testSourceID, 8, time.Now().Add(-2*day)))
+	assert.NoError(t, tx.Commit())
+
+	tests := []struct {
+		limit    int
+		expected []int
+	}{
+		{10, []int{1, 4, 5, 7}},
+		{3, []int{1, 4, 5}},
+		{1, []int{1}},
+	}
+
+	for _, test := range tests {
+		ids, err := refreshTopicIDs(testSourceID, test.limit)
+		assert.NoError(t, err, test.limit)
+		assert.Equal(t, test.expected, ids, test.limit)
+	}
+
+	// Темы другого источника не выбираются
+	ids, err := refreshTopicIDs(testSourceID+1, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestSaveRefreshResult(t *testing.T) {
+	newTestDb(t)
+
+	refreshedBefore := time.Now().Add(-time.Hour)
+	for id := 1; id <= 3; id++ {
+		insertRefreshTestTorrent(t, id, time.Hour, 2*time.Hour)
+	}
+
+	changed := newTestTorrent(1)
+	changed.Title = "Movie 1 (changed)"
+
+	transientErr := fmt.Errorf("%w: 503", sources.ErrTransient)
+
+	assert.NoError(t, saveRefreshResult(testSourceID, parseResult{1, changed, nil}))
+	assert.NoError(t, saveRefreshResult(testSourceID, parseResult{2, nil, sources.ErrDeleted}))
+	assert.NoError(t, saveRefreshResult(testSourceID, parseResult{3, nil, transientErr}))
+
+	// Время проверки обновлено у всех тем, в том числе при ошибке
+	ids, err := db.GetRefreshTopicIDs(testSourceID, time.Time{}, time.Now(), refreshedBefore, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+
+	result, err := db.SearchTorrentByBtih(newTestTorrent(1).Btih)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Movie 1 (changed)", result.Title)
+		assert.True(t, result.IsChanged())
+	}
+
+	removed, err := db.SearchTorrentByBtih(newTestTorrent(2).Btih)
+	if assert.NoError(t, err) {
+		assert.False(t, removed.RemoveTime.IsZero())
+	}
+
+	result, err = db.SearchTorrentByBtih(newTestTorrent(3).Btih)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Movie 3", result.Title)
+		assert.True(t, result.RemoveTime.IsZero())
+	}
+
+	// Повторное обнаружение удаления не меняет время первого обнаружения
+	assert.NoError(t, saveRefreshResult(testSourceID, parseResult{2, nil, sources.ErrNotFound}))
+	result, err = db.SearchTorrentByBtih(newTestTorrent(2).Btih)
+	if assert.NoError(t, err) {
+		assert.True(t, result.RemoveTime.Equal(removed.RemoveTime), "%v != %v", result.RemoveTime, removed.RemoveTime)
+	}
+
+	// Снова появившаяся на источнике тема считается доступной
+	assert.NoError(t, saveRefreshResult(testSourceID, parseResult{2, newTestTorrent(2), nil}))
+	result, err = db.SearchTorrentByBtih(newTestTorrent(2).Btih)
+	if assert.NoError(t, err) {
+		assert.True(t, result.RemoveTime.IsZero())
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	newTestDb(t)
+
+	for id := 1; id <= 4; id++ {
+		insertRefreshTestTorrent(t, id, time.Hour, 2*24*time.Hour)
+	}
+
+	currentTestSource = &testSource{
+		maxID: 4,
+		errs: map[int]error{
+			2: sources.ErrNotFound,
+			3: errors.New("unknown error")}}
+	defer func() { currentTestSource = new(testSource) }()
+
+	assert.NoError(t, refresh("test"))
+
+	// Удалённая тема остаётся в базе
+	assert.Equal(t, []int{1, 2, 3, 4}, topicIDs(t))
+
+	ids, err := refreshTopicIDs(testSourceID, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+
+	result, err := db.SearchTorrentByBtih(newTestTorrent(2).Btih)
+	if assert.NoError(t, err) {
+		assert.False(t, result.RemoveTime.IsZero())
+	}
+}
@@ -0,0 +1,155 @@
+// Package render преобразует markdown-описания торрентов в безопасный HTML.
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Режимы обработки изображений в описаниях
+const (
+	// Изображения загружаются браузером напрямую со сторонних сайтов
+	ImagesAllow = "allow"
+
+	// Изображения загружаются через прокси сервера
+	ImagesProxy = "proxy"
+
+	// Изображения заменяются ссылками
+	ImagesBlock = "block"
+)
+
+type Renderer struct {
+	policy   *bluemonday.Policy
+	images   string
+	proxyURL func(src string) string
+}
+
+// New создаёт обработчик описаний. proxyURL используется только в режиме
+// ImagesProxy и должна возвращать адрес прокси для указанного изображения.
+func New(images string, proxyURL func(src string) string) *Renderer {
+	policy := bluemonday.UGCPolicy()
+	policy.RequireNoFollowOnLinks(true)
+	policy.RequireNoReferrerOnLinks(true)
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return &Renderer{policy: policy, images: images, proxyURL: proxyURL}
+}
+
+// Render преобразует markdown в HTML, удаляя всё, что может быть исполнено браузером
+func (renderer *Renderer) Render(markdown string) template.HTML {
+	// Одиночные переносы строк в описаниях являются значимыми
+	markdown = strings.ReplaceAll(markdown, "\n\n", "<newline>")
+	markdown = strings.ReplaceAll(markdown, "\n", "<br>")
+	markdown = strings.ReplaceAll(markdown, "<newline>", "\n\n")
+
+	b := blackfriday.Run([]byte(markdown))
+
+	b = renderer.rewriteImages(b)
+
+	return template.HTML(renderer.policy.SanitizeBytes(b))
+}
+
+// rewriteImages заменяет адреса изображений в соответствии с режимом.
+// Результат в любом случае проходит последующую очистку.
+func (renderer *Renderer) rewriteImages(b []byte) []byte {
+	if renderer.images == ImagesAllow {
+		return b
+	}
+
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+
+	nodes, err := html.ParseFragment(bytes.NewReader(b), context)
+	if err != nil {
+		// Без изображений ничего не теряется в плане безопасности
+		return renderer.policy.SanitizeBytes(b)
+	}
+
+	for _, node := range nodes {
+		renderer.rewriteNode(node)
+	}
+
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		err = html.Render(&buf, node)
+		if err != nil {
+			return nil
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func (renderer *Renderer) rewriteNode(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		renderer.rewriteNode(child)
+	}
+
+	if node.Type != html.ElementNode || node.DataAtom != atom.Img {
+		return
+	}
+
+	src := attr(node, "src")
+
+	switch renderer.images {
+	case ImagesProxy:
+		if src == "" || !isRemoteURL(src) {
+			removeAttr(node, "src")
+			return
+		}
+
+		setAttr(node, "src", renderer.proxyURL(src))
+	default:
+		// Замена изображения ссылкой на него
+		node.DataAtom = atom.A
+		node.Data = "a"
+		node.Attr = nil
+		if isRemoteURL(src) {
+			node.Attr = []html.Attribute{{Key: "href", Val: src}}
+		}
+		node.AppendChild(&html.Node{Type: html.TextNode, Data: "[изображение]"})
+	}
+}
+
+func isRemoteURL(s string) bool {
+	s = strings.ToLower(s)
+
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func attr(node *html.Node, key string) string {
+	for _, a := range node.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+func setAttr(node *html.Node, key, value string) {
+	for i, a := range node.Attr {
+		if a.Namespace == "" && a.Key == key {
+			node.Attr[i].Val = value
+			return
+		}
+	}
+
+	node.Attr = append(node.Attr, html.Attribute{Key: key, Val: value})
+}
+
+func removeAttr(node *html.Node, key string) {
+	attrs := node.Attr[:0]
+	for _, a := range node.Attr {
+		if a.Namespace == "" && a.Key == key {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	node.Attr = attrs
+}
@@ -0,0 +1,74 @@
+package render
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testProxyURL(src string) string {
+	return "/image?url=" + url.QueryEscape(src)
+}
+
+func readFixture(t *testing.T, name string) string {
+	b, err := ioutil.ReadFile("testdata/" + name)
+	assert.NoError(t, err)
+
+	return string(b)
+}
+
+func TestRenderRemovesHostileContent(t *testing.T) {
+	markdown := readFixture(t, "hostile.md")
+
+	for _, images := range []string{ImagesAllow, ImagesProxy, ImagesBlock} {
+		got := strings.ToLower(string(New(images, testProxyURL).Render(markdown)))
+
+		for _, forbidden := range []string{
+			"<script", "<iframe", "<svg", "<object", "<form", "<input", "<meta", "<base", "<style",
+			"onerror", "onload", "onclick", "style=", "javascript:", "data:text/html"} {
+			assert.NotContains(t, got, forbidden, "images mode %s", images)
+		}
+
+		assert.Contains(t, got, "название:")
+		assert.Contains(t, got, `href="https://example.com/page"`)
+	}
+}
+
+func TestRenderLinksAreNoFollow(t *testing.T) {
+	got := string(New(ImagesAllow, testProxyURL).Render("[ссылка](https://example.com/page)"))
+
+	assert.Contains(t, got, `rel="nofollow noreferrer noopener"`)
+	assert.Contains(t, got, `target="_blank"`)
+}
+
+func TestRenderImagesProxy(t *testing.T) {
+	got := string(New(ImagesProxy, testProxyURL).Render("![постер](https://example.com/poster.jpg)\n\n<img src=\"/local.png\">"))
+
+	assert.Contains(t, got, `src="/image?url=https%3A%2F%2Fexample.com%2Fposter.jpg"`)
+	assert.NotContains(t, got, `src="https://example.com/poster.jpg"`)
+	assert.NotContains(t, got, "local.png")
+}
+
+func TestRenderImagesBlock(t *testing.T) {
+	got := string(New(ImagesBlock, testProxyURL).Render("![постер](https://example.com/poster.jpg)"))
+
+	assert.NotContains(t, got, "<img")
+	assert.Contains(t, got, `href="https://example.com/poster.jpg"`)
+	assert.Contains(t, got, "[изображение]")
+}
+
+func TestRenderImagesAllow(t *testing.T) {
+	got := string(New(ImagesAllow, testProxyURL).Render("![постер](https://example.com/poster.jpg)"))
+
+	assert.Contains(t, got, `src="https://example.com/poster.jpg"`)
+}
+
+func TestRenderLineBreaks(t *testing.T) {
+	got := string(New(ImagesAllow, testProxyURL).Render("строка 1\nстрока 2\n\nабзац"))
+
+	assert.Contains(t, got, "строка 1<br>строка 2")
+	assert.Contains(t, got, "<p>абзац</p>")
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/nxshock/torrentdb/sources"
+)
+
+// Периодическая задача демона
+type Job struct {
+	Name string
+	Spec string
+
+	schedule cron.Schedule
+	run      func() error
+
+	mutex     sync.Mutex
+	running   bool
+	lastStart time.Time
+	lastEnd   time.Time
+	lastError error
+	nextRun   time.Time
+}
+
+// Состояние задачи для отображения
+type JobStatus struct {
+	Name      string
+	Spec      string
+	Running   bool
+	LastStart time.Time
+	LastEnd   time.Time
+	LastError string
+	NextRun   time.Time
+}
+
+type Scheduler struct {
+	jobs []*Job
+	wg   sync.WaitGroup
+	stop chan struct{}
+}
+
+var scheduler *Scheduler
+
+func initScheduler() error {
+	scheduler = &Scheduler{stop: make(chan struct{})}
+
+	var sourceNames []string
+	for sourceName := range config.Schedule {
+		sourceNames = append(sourceNames, sourceName)
+	}
+	sort.Strings(sourceNames)
+
+	registeredDrivers := make(map[string]bool)
+	for _, driverName := range sources.RegisteredDrivers() {
+		registeredDrivers[driverName] = true
+	}
+
+	for _, sourceName := range sourceNames {
+		if !registeredDrivers[sourceName] {
+			return fmt.Errorf("schedule: unknown source %q", sourceName)
+		}
+
+		if !config.Source(sourceName).Enabled {
+			log.Printf("Source %s is disabled, schedule skipped", sourceName)
+			continue
+		}
+
+		scheduleConfig := config.Schedule[sourceName]
+		sourceName := sourceName
+
+		if scheduleConfig.Update != "" {
+			err := scheduler.Add(sourceName+" update", scheduleConfig.Update, func() error {
+				err := update(sourceName, "")
+				if err == errDatabaseIsUpToDate {
+					return nil
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if scheduleConfig.Stats != "" {
+			err := scheduler.Add(sourceName+" stats", scheduleConfig.Stats, func() error {
+				return updateStats(sourceName)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if scheduleConfig.Scrape != "" {
+			err := scheduler.Add(sourceName+" scrape", scheduleConfig.Scrape, func() error {
+				return scrapeTrackers(sourceName)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if scheduleConfig.Refresh != "" {
+			err := scheduler.Add(sourceName+" refresh", scheduleConfig.Refresh, func() error {
+				return refresh(sourceName)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	scheduler.Start()
+
+	return nil
+}
+
+// parseSchedule разбирает расписание: продолжительность ("30m"),
+// cron-выражение ("0 3 * * *") или описатель ("@daily", "@every 1h")
+func parseSchedule(spec string) (cron.Schedule, error) {
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("non-positive interval: %s", spec)
+		}
+
+		return cron.Every(d), nil
+	}
+
+	return cron.ParseStandard(spec)
+}
+
+func (scheduler *Scheduler) Add(name, spec string, run func() error) error {
+	schedule, err := parseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("schedule %s: %v", name, err)
+	}
+
+	scheduler.jobs = append(scheduler.jobs, &Job{Name: name, Spec: spec, schedule: schedule, run: run})
+
+	return nil
+}
+
+func (scheduler *Scheduler) Start() {
+	for _, job := range scheduler.jobs {
+		log.Printf("Scheduling %s (%s).", job.Name, job.Spec)
+
+		scheduler.wg.Add(1)
+		go scheduler.loop(job)
+	}
+}
+
+// Stop прекращает планирование новых запусков, прерывает текущие
+// обновления и ожидает их завершения
+func (scheduler *Scheduler) Stop() {
+	close(scheduler.stop)
+	close(stopUpdate)
+	scheduler.wg.Wait()
+}
+
+func (scheduler *Scheduler) loop(job *Job) {
+	defer scheduler.wg.Done()
+
+	for {
+		next := job.schedule.Next(time.Now())
+
+		job.mutex.Lock()
+		job.nextRun = next
+		job.mutex.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			scheduler.tryRun(job)
+		case <-scheduler.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// tryRun запускает задачу, если предыдущий запуск уже завершён
+func (scheduler *Scheduler) tryRun(job *Job) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+
+	if job.running {
+		log.Printf("%s: previous run is still in progress, skipping.", job.Name)
+		return
+	}
+
+	job.running = true
+	job.lastStart = time.Now()
+
+	scheduler.wg.Add(1)
+	go func() {
+		defer scheduler.wg.Done()
+
+		log.Printf("%s: started.", job.Name)
+		err := job.run()
+		if err != nil {
+			log.Printf("%s: %v", job.Name, err)
+		} else {
+			log.Printf("%s: completed.", job.Name)
+		}
+
+		job.mutex.Lock()
+		job.running = false
+		job.lastEnd = time.Now()
+		job.lastError = err
+		job.mutex.Unlock()
+	}()
+}
+
+func (scheduler *Scheduler) Status() []JobStatus {
+	var statuses []JobStatus
+
+	for _, job := range scheduler.jobs {
+		job.mutex.Lock()
+		status := JobStatus{
+			Name:      job.Name,
+			Spec:      job.Spec,
+			Running:   job.running,
+			LastStart: job.lastStart,
+			LastEnd:   job.lastEnd,
+			NextRun:   job.nextRun}
+		if job.lastError != nil {
+			status.LastError = job.lastError.Error()
+		}
+		job.mutex.Unlock()
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
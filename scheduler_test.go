@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 20, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		expected time.Time // следующий запуск после start, нулевое значение - ошибка
+	}{
+		{"30m", start.Add(30 * time.Minute)},
+		{"1h30m", start.Add(90 * time.Minute)},
+		{"0 3 * * *", time.Date(2020, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@every 2h", start.Add(2 * time.Hour)},
+		{"0s", time.Time{}},
+		{"-5m", time.Time{}},
+		{"", time.Time{}},
+		{"every hour", time.Time{}},
+		{"0 25 * * *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		schedule, err := parseSchedule(test.spec)
+		if test.expected.IsZero() {
+			assert.Error(t, err, test.spec)
+			continue
+		}
+
+		if assert.NoError(t, err, test.spec) {
+			assert.Equal(t, test.expected, schedule.Next(start), test.spec)
+		}
+	}
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	scheduler := &Scheduler{stop: make(chan struct{})}
+
+	assert.NoError(t, scheduler.Add("job", "1h", func() error { return nil }))
+	err := scheduler.Add("bad job", "sometimes", func() error { return nil })
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "schedule bad job:")
+	}
+	assert.Len(t, scheduler.jobs, 1)
+}
+
+func TestSchedulerTryRun(t *testing.T) {
+	scheduler := &Scheduler{stop: make(chan struct{})}
+
+	var runs int32
+	release := make(chan struct{})
+	errRun := errors.New("run error")
+
+	assert.NoError(t, scheduler.Add("job", "1h", func() error {
+		atomic.AddInt32(&runs, 1)
+		<-release
+		return errRun
+	}))
+	job := scheduler.jobs[0]
+
+	// Повторный запуск во время выполнения пропускается
+	scheduler.tryRun(job)
+	scheduler.tryRun(job)
+
+	status := scheduler.Status()
+	if assert.Len(t, status, 1) {
+		assert.True(t, status[0].Running)
+		assert.False(t, status[0].LastStart.IsZero())
+	}
+
+	close(release)
+	scheduler.wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+	status = scheduler.Status()
+	assert.False(t, status[0].Running)
+	assert.Equal(t, "run error", status[0].LastError)
+	assert.False(t, status[0].LastEnd.Before(status[0].LastStart))
+
+	// После завершения задача запускается снова
+	scheduler.tryRun(job)
+	scheduler.wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+}
+
+func TestSchedulerStop(t *testing.T) {
+	defer func() { stopUpdate = make(chan struct{}) }()
+
+	scheduler := &Scheduler{stop: make(chan struct{})}
+
+	// Задача завершается только после сигнала прерывания обновлений
+	started := make(chan struct{})
+	var interrupted int32
+	assert.NoError(t, scheduler.Add("long job", "1h", func() error {
+		close(started)
+		<-stopUpdate
+		atomic.StoreInt32(&interrupted, 1)
+		return errUpdateInterrupted
+	}))
+	assert.NoError(t, scheduler.Add("idle job", "1h", func() error { return nil }))
+
+	scheduler.Start()
+	scheduler.tryRun(scheduler.jobs[0])
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		scheduler.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler did not stop")
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&interrupted))
+	assert.False(t, scheduler.Status()[0].Running)
+}
@@ -0,0 +1,117 @@
+package scrape
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/nxshock/torrentdb/torrent/bencode"
+)
+
+// Кол-во infohash в одном HTTP-запросе, ограничено длиной URL
+const httpMaxInfoHashes = 50
+
+// Максимальный размер ответа трекера
+const httpMaxResponseSize = 1 << 20
+
+// scrapeURL возвращает адрес scrape по адресу анонса:
+// последний элемент пути "announce" заменяется на "scrape" (BEP 48)
+func scrapeURL(announceURL *url.URL) (string, error) {
+	dir, file := path.Split(announceURL.Path)
+	if !strings.HasPrefix(file, "announce") {
+		return "", ErrNotSupported
+	}
+
+	u := *announceURL
+	u.Path = dir + "scrape" + strings.TrimPrefix(file, "announce")
+	u.RawPath = ""
+
+	return u.String(), nil
+}
+
+func (client *Client) scrapeHTTP(scrapeURL string, infoHashes []InfoHash, results map[InfoHash]Result) error {
+	var query []string
+	for _, infoHash := range infoHashes {
+		query = append(query, "info_hash="+url.QueryEscape(string(infoHash[:])))
+	}
+
+	separator := "?"
+	if strings.Contains(scrapeURL, "?") {
+		separator = "&"
+	}
+
+	resp, err := client.HTTPClient.Get(scrapeURL + separator + strings.Join(query, "&"))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &TrackerError{scrapeURL, "unexpected status: " + resp.Status}
+	}
+
+	// Лишний байт сверх лимита позволяет отличить слишком большой ответ от ответа предельного размера
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, httpMaxResponseSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > httpMaxResponseSize {
+		return &TrackerError{scrapeURL, "response is too large"}
+	}
+
+	return parseHTTPResponse(scrapeURL, data, results)
+}
+
+// parseHTTPResponse разбирает ответ вида
+// d5:filesd20:<infohash>d8:completei5e10:downloadedi50e10:incompletei10eeee
+func parseHTTPResponse(scrapeURL string, data []byte, results map[InfoHash]Result) error {
+	v, err := bencode.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	root, ok := v.(map[string]interface{})
+	if !ok {
+		return &TrackerError{scrapeURL, "response is not a dictionary"}
+	}
+
+	if reason, ok := root["failure reason"].(string); ok {
+		return &TrackerError{scrapeURL, reason}
+	}
+
+	files, ok := root["files"].(map[string]interface{})
+	if !ok {
+		return &TrackerError{scrapeURL, "files dictionary not found"}
+	}
+
+	for key, value := range files {
+		if len(key) != len(InfoHash{}) {
+			return &TrackerError{scrapeURL, fmt.Sprintf("wrong infohash length: %d", len(key))}
+		}
+
+		stats, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var infoHash InfoHash
+		copy(infoHash[:], key)
+
+		results[infoHash] = Result{
+			Seeders:   intValue(stats, "complete"),
+			Leechers:  intValue(stats, "incomplete"),
+			Completed: intValue(stats, "downloaded")}
+	}
+
+	return nil
+}
+
+func intValue(dict map[string]interface{}, key string) int {
+	n, _ := dict[key].(int64)
+
+	return int(n)
+}
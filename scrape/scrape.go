@@ -0,0 +1,118 @@
+// Package scrape запрашивает у трекеров статистику раздач
+// по протоколам HTTP (BEP 48) и UDP (BEP 15).
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Статистика раздачи по данным трекера
+type Result struct {
+	Seeders   int
+	Leechers  int
+	Completed int
+}
+
+// InfoHash - v1 infohash раздачи
+type InfoHash [20]byte
+
+// ErrNotSupported возвращается для трекеров, не поддерживающих scrape
+var ErrNotSupported = errors.New("scrape: tracker does not support scrape")
+
+// Ошибка, возвращённая трекером
+type TrackerError struct {
+	Tracker string
+	Msg     string
+}
+
+func (e *TrackerError) Error() string {
+	return fmt.Sprintf("scrape: %s: %s", e.Tracker, e.Msg)
+}
+
+type Client struct {
+	// Таймаут одного запроса к трекеру
+	Timeout time.Duration
+
+	// Кол-во повторов UDP-запроса при отсутствии ответа
+	UDPRetries int
+
+	// Клиент для HTTP-трекеров
+	HTTPClient *http.Client
+
+	// Соединения с HTTP- и UDP-трекерами устанавливаются через Dialer,
+	// например, для запрета обращения к адресам локальной сети через Control
+	Dialer *net.Dialer
+}
+
+// NewClient создаёт клиент с таймаутом timeout на один запрос
+func NewClient(timeout time.Duration) *Client {
+	client := &Client{
+		Timeout:    timeout,
+		UDPRetries: 2,
+		Dialer:     &net.Dialer{Timeout: timeout}}
+
+	client.HTTPClient = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return client.Dialer.DialContext(ctx, network, address)
+			}}}
+
+	return client
+}
+
+// Scrape запрашивает статистику раздач у трекера, указанного адресом анонса.
+// Запросы разбиваются на пакеты допустимого для протокола размера.
+// Раздачи, неизвестные трекеру, в результат не попадают.
+func (client *Client) Scrape(announceURL string, infoHashes []InfoHash) (map[InfoHash]Result, error) {
+	u, err := url.Parse(announceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		batchSize   int
+		scrapeBatch func([]InfoHash, map[InfoHash]Result) error
+	)
+
+	switch u.Scheme {
+	case "udp":
+		batchSize = udpMaxInfoHashes
+		scrapeBatch = func(batch []InfoHash, results map[InfoHash]Result) error {
+			return client.scrapeUDP(u.Host, batch, results)
+		}
+	case "http", "https":
+		scrapeURL, err := scrapeURL(u)
+		if err != nil {
+			return nil, err
+		}
+
+		batchSize = httpMaxInfoHashes
+		scrapeBatch = func(batch []InfoHash, results map[InfoHash]Result) error {
+			return client.scrapeHTTP(scrapeURL, batch, results)
+		}
+	default:
+		return nil, ErrNotSupported
+	}
+
+	results := make(map[InfoHash]Result)
+	for from := 0; from < len(infoHashes); from += batchSize {
+		to := from + batchSize
+		if to > len(infoHashes) {
+			to = len(infoHashes)
+		}
+
+		err = scrapeBatch(infoHashes[from:to], results)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
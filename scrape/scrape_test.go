@@ -0,0 +1,200 @@
+package scrape
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/torrent/bencode"
+)
+
+var (
+	knownHash   = InfoHash{1, 2, 3}
+	unknownHash = InfoHash{4, 5, 6}
+)
+
+// fakeUDPTracker отвечает на connect и scrape, раздача knownHash имеет 5 сидов,
+// 10 скачиваний и 2 личей. Первый пакет игнорируется при dropFirst.
+func fakeUDPTracker(t *testing.T, dropFirst bool) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		const connectionID = 0x1122334455667788
+
+		buf := make([]byte, 2048)
+		for packetNum := 0; ; packetNum++ {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if dropFirst && packetNum == 0 {
+				continue
+			}
+
+			request := buf[:n]
+			response := make([]byte, 8)
+			copy(response[4:], request[12:16])
+
+			switch binary.BigEndian.Uint32(request[8:]) {
+			case udpActionConnect:
+				binary.BigEndian.PutUint32(response, udpActionConnect)
+				response = append(response, make([]byte, 8)...)
+				binary.BigEndian.PutUint64(response[8:], connectionID)
+			case udpActionScrape:
+				if binary.BigEndian.Uint64(request) != connectionID {
+					binary.BigEndian.PutUint32(response, udpActionError)
+					response = append(response, "wrong connection id"...)
+					break
+				}
+
+				binary.BigEndian.PutUint32(response, udpActionScrape)
+				for i := 16; i+20 <= n; i += 20 {
+					var infoHash InfoHash
+					copy(infoHash[:], request[i:i+20])
+
+					entry := make([]byte, 12)
+					if infoHash == knownHash {
+						binary.BigEndian.PutUint32(entry[0:], 5)
+						binary.BigEndian.PutUint32(entry[4:], 10)
+						binary.BigEndian.PutUint32(entry[8:], 2)
+					}
+					response = append(response, entry...)
+				}
+			}
+
+			conn.WriteTo(response, addr)
+		}
+	}()
+
+	return "udp://" + conn.LocalAddr().String() + "/announce"
+}
+
+func TestScrapeUDP(t *testing.T) {
+	client := NewClient(200 * time.Millisecond)
+
+	results, err := client.Scrape(fakeUDPTracker(t, true), []InfoHash{knownHash, unknownHash})
+	assert.NoError(t, err)
+	assert.Equal(t, map[InfoHash]Result{knownHash: {Seeders: 5, Leechers: 2, Completed: 10}}, results)
+}
+
+func TestScrapeUDPTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client := NewClient(50 * time.Millisecond)
+
+	_, err = client.Scrape("udp://"+conn.LocalAddr().String(), []InfoHash{knownHash})
+	assert.Equal(t, errUDPTimeout, err)
+}
+
+func TestScrapeHTTP(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/tracker/scrape.php", r.URL.Path)
+		assert.Equal(t, "secret", r.URL.Query().Get("pk"))
+
+		files := make(map[string]interface{})
+		for _, infoHash := range r.URL.Query()["info_hash"] {
+			if infoHash == string(knownHash[:]) {
+				files[infoHash] = map[string]interface{}{"complete": int64(5), "incomplete": int64(2), "downloaded": int64(10)}
+			}
+		}
+
+		b, err := bencode.Encode(map[string]interface{}{"files": files})
+		assert.NoError(t, err)
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	infoHashes := []InfoHash{knownHash}
+	for i := 0; i < httpMaxInfoHashes; i++ {
+		infoHashes = append(infoHashes, InfoHash{0xff, byte(i)})
+	}
+
+	client := NewClient(time.Second)
+
+	results, err := client.Scrape(server.URL+"/tracker/announce.php?pk=secret", infoHashes)
+	assert.NoError(t, err)
+	assert.Equal(t, map[InfoHash]Result{knownHash: {Seeders: 5, Leechers: 2, Completed: 10}}, results)
+	assert.Equal(t, 2, requests)
+}
+
+func TestScrapeHTTPFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("d14:failure reason11:not allowede"))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second).Scrape(server.URL+"/announce", []InfoHash{knownHash})
+	assert.EqualError(t, err, "scrape: "+server.URL+"/scrape: not allowed")
+}
+
+func TestScrapeHTTPTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, httpMaxResponseSize+1))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second).Scrape(server.URL+"/announce", []InfoHash{knownHash})
+	assert.EqualError(t, err, "scrape: "+server.URL+"/scrape: response is too large")
+}
+
+func TestScrapeURL(t *testing.T) {
+	tests := []struct {
+		announce string
+		scrape   string
+		err      error
+	}{
+		{"http://example.com/announce", "http://example.com/scrape", nil},
+		{"http://example.com/x/announce.php?pk=1", "http://example.com/x/scrape.php?pk=1", nil},
+		{"http://example.com/a", "", ErrNotSupported},
+		{"http://example.com/announce/x", "", ErrNotSupported},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.announce)
+		assert.NoError(t, err)
+
+		scrape, err := scrapeURL(u)
+		assert.Equal(t, test.err, err)
+		assert.Equal(t, test.scrape, scrape)
+	}
+}
+
+func TestScrapeUnsupportedScheme(t *testing.T) {
+	_, err := NewClient(time.Second).Scrape("wss://example.com/announce", []InfoHash{knownHash})
+	assert.Equal(t, ErrNotSupported, err)
+}
+
+func TestScrapeDialerControl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request must not be sent")
+	}))
+	defer server.Close()
+
+	errDenied := errors.New("denied")
+
+	client := NewClient(200 * time.Millisecond)
+	client.Dialer.Control = func(network, address string, c syscall.RawConn) error {
+		return errDenied
+	}
+
+	for _, tracker := range []string{server.URL + "/announce", fakeUDPTracker(t, false)} {
+		_, err := client.Scrape(tracker, []InfoHash{knownHash})
+		assert.True(t, errors.Is(err, errDenied), "%s: %v", tracker, err)
+	}
+}
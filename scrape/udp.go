@@ -0,0 +1,127 @@
+package scrape
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+// Кол-во infohash в одном UDP-запросе, ограничено размером пакета (BEP 15)
+const udpMaxInfoHashes = 74
+
+const (
+	udpProtocolID = 0x41727101980
+
+	udpActionConnect = 0
+	udpActionScrape  = 2
+	udpActionError   = 3
+)
+
+var errUDPTimeout = errors.New("scrape: udp tracker did not respond")
+
+func (client *Client) scrapeUDP(host string, infoHashes []InfoHash, results map[InfoHash]Result) error {
+	conn, err := client.Dialer.Dial("udp", host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	connectRequest := make([]byte, 16)
+	binary.BigEndian.PutUint64(connectRequest[0:], udpProtocolID)
+	binary.BigEndian.PutUint32(connectRequest[8:], udpActionConnect)
+
+	connectResponse, err := client.udpRoundTrip(conn, host, connectRequest, 16)
+	if err != nil {
+		return err
+	}
+	connectionID := binary.BigEndian.Uint64(connectResponse[8:])
+
+	scrapeRequest := make([]byte, 16, 16+len(infoHashes)*len(InfoHash{}))
+	binary.BigEndian.PutUint64(scrapeRequest[0:], connectionID)
+	binary.BigEndian.PutUint32(scrapeRequest[8:], udpActionScrape)
+	for _, infoHash := range infoHashes {
+		scrapeRequest = append(scrapeRequest, infoHash[:]...)
+	}
+
+	scrapeResponse, err := client.udpRoundTrip(conn, host, scrapeRequest, 8+12*len(infoHashes))
+	if err != nil {
+		return err
+	}
+
+	// Статистика возвращается в порядке запроса
+	for i, infoHash := range infoHashes {
+		entry := scrapeResponse[8+12*i:]
+		result := Result{
+			Seeders:   int(binary.BigEndian.Uint32(entry[0:])),
+			Completed: int(binary.BigEndian.Uint32(entry[4:])),
+			Leechers:  int(binary.BigEndian.Uint32(entry[8:]))}
+
+		// Трекеры возвращают нули для неизвестных раздач
+		if result != (Result{}) {
+			results[infoHash] = result
+		}
+	}
+
+	return nil
+}
+
+// udpRoundTrip отправляет запрос со случайным transaction_id и ожидает ответ
+// с тем же действием и transaction_id, повторяя запрос при отсутствии ответа.
+// Ответы короче minSize считаются ошибкой.
+func (client *Client) udpRoundTrip(conn net.Conn, host string, request []byte, minSize int) ([]byte, error) {
+	action := binary.BigEndian.Uint32(request[8:])
+
+	transactionID := make([]byte, 4)
+	_, err := rand.Read(transactionID)
+	if err != nil {
+		return nil, err
+	}
+	copy(request[12:], transactionID)
+
+	response := make([]byte, 8+12*udpMaxInfoHashes)
+	for attempt := 0; attempt <= client.UDPRetries; attempt++ {
+		_, err = conn.Write(request)
+		if err != nil {
+			return nil, err
+		}
+
+		err = conn.SetReadDeadline(time.Now().Add(client.Timeout))
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			n, err := conn.Read(response)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+
+				return nil, err
+			}
+
+			// Ответы на предыдущие попытки и посторонние пакеты пропускаются
+			if n < 8 || string(response[4:8]) != string(transactionID) {
+				continue
+			}
+
+			switch binary.BigEndian.Uint32(response[0:]) {
+			case action:
+				if n < minSize {
+					return nil, &TrackerError{host, "response is too short"}
+				}
+
+				return response[:n], nil
+			case udpActionError:
+				return nil, &TrackerError{host, string(response[8:n])}
+			default:
+				return nil, &TrackerError{host, "unexpected action in response"}
+			}
+		}
+	}
+
+	return nil, errUDPTimeout
+}
@@ -1,19 +1,37 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/hex"
+	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"path/filepath"
-	"strings"
-
-	"github.com/russross/blackfriday/v2"
+	"strconv"
+	"sync"
 
+	"github.com/nxshock/torrentdb/render"
 	"github.com/nxshock/torrentdb/torrent"
 )
 
-var templates *template.Template
+// Максимальное кол-во подсчитываемых результатов поиска,
+// при превышении выводится "более N"
+const searchMaxCount = 10000
+
+var (
+	templates *template.Template
+	servers   []*http.Server
+
+	descriptionRenderer *render.Renderer
+)
+
+var templateFuncs = template.FuncMap{
+	"add":        func(a, b int) int { return a + b },
+	"sourceName": sourceName,
+	"topicURL":   topicURL}
 
 func initServer() {
 	templatesDir := filepath.Join(config.Main.SiteDir)
@@ -26,21 +44,105 @@ func initServer() {
 	log.Printf("Found %d templates.", len(files))
 
 	log.Printf("Reading templates data...")
-	templates, err = template.New("").ParseFiles(files...)
+	templates, err = template.New("").Funcs(templateFuncs).ParseFiles(files...)
 	if err != nil {
 		log.Fatalln("read template error:", err)
 	}
 
-	http.HandleFunc("/torrent", torrentHandler)
-	http.HandleFunc("/search", searchHandler)
-	http.HandleFunc("/", rootHandler)
+	descriptionRenderer = render.New(config.Main.DescriptionImages, imageProxyURL)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/torrent", torrentHandler)
+	mux.HandleFunc("/image", imageProxyHandler)
+	mux.HandleFunc("/search", searchHandler)
+	mux.HandleFunc("/admin", adminHandler)
+	mux.HandleFunc("/api/v1/search", apiSearchHandler)
+	mux.HandleFunc("/api/v1/torrent/", apiTorrentHandler)
+	mux.HandleFunc("/api/", apiNotFoundHandler)
+	mux.HandleFunc("/torznab/api", torznabHandler)
+	mux.HandleFunc("/", rootHandler)
+
+	err = startServers(mux)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// startServers запускает HTTP-серверы на всех адресах config.Server.Listen
+func startServers(handler http.Handler) error {
+	tlsConfig, err := serverTLSConfig()
+	if err != nil {
+		return fmt.Errorf("load TLS certificate error: %v", err)
+	}
 
-	go func() {
-		err := http.ListenAndServe(":80", nil)
+	for _, addr := range config.Server.Listen {
+		listener, err := net.Listen("tcp", addr)
 		if err != nil {
-			log.Fatalln("listen http port error:", err)
+			return fmt.Errorf("listen http port error: %v", err)
+		}
+
+		scheme := "http"
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+			scheme = "https"
 		}
-	}()
+
+		server := &http.Server{
+			Handler:      handler,
+			ReadTimeout:  config.Server.ReadTimeout.Duration,
+			WriteTimeout: config.Server.WriteTimeout.Duration,
+			IdleTimeout:  config.Server.IdleTimeout.Duration}
+		servers = append(servers, server)
+
+		log.Printf("Listening on %s (%s)...", listener.Addr(), scheme)
+		go func() {
+			err := server.Serve(listener)
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatalln("serve http error:", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// serverTLSConfig загружает сертификат и ключ TLS из конфигурации,
+// nil - сервер работает по http
+func serverTLSConfig() (*tls.Config, error) {
+	if config.Server.TLSCert == "" {
+		return nil, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(config.Server.TLSCert, config.Server.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"}}, nil
+}
+
+// stopServer прекращает приём новых подключений и ожидает завершения
+// текущих запросов, но не дольше config.Server.ShutdownTimeout
+func stopServer() {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Server.ShutdownTimeout.Duration)
+	defer cancel()
+
+	wg := new(sync.WaitGroup)
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+
+			err := server.Shutdown(ctx)
+			if err != nil {
+				log.Printf("Shutdown http server error: %v", err)
+			}
+		}(server)
+	}
+	wg.Wait()
 }
 
 func torrentHandler(w http.ResponseWriter, r *http.Request) {
@@ -56,11 +158,27 @@ func torrentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Подготовка markdown
-	torrent.Body = template.HTML(strings.ReplaceAll(string(torrent.Body), "\n\n", "<newline>"))
-	torrent.Body = template.HTML(strings.ReplaceAll(string(torrent.Body), "\n", "<br>"))
-	torrent.Body = template.HTML(strings.ReplaceAll(string(torrent.Body), "<newline>", "\n\n"))
-	torrent.Body = template.HTML(string(blackfriday.Run([]byte(torrent.Body))))
+	torrent.Body = descriptionRenderer.Render(string(torrent.Body))
+
+	torrent.Files, err = db.GetFiles(torrent.SourceID, torrent.TopicID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if torrent.IsChanged() {
+		torrent.History, err = db.GetHistory(torrent.SourceID, torrent.TopicID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	torrent.Listings, err = db.GetListings(btih)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
@@ -73,17 +191,42 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 		Query          string
 		OrderBy        SortField
 		OrderDirection SortDirection
+		Category       string
+		Categories     []torrent.Category
 		List           []*torrent.Torrent
+
+		Page       int
+		PageCount  int
+		Pages      []int
+		Total      int
+		TotalIsMax bool
 	}
 
 	query := r.FormValue("query") // TODO: отфильтровать запрос
 	sortBy := SortField(r.FormValue("orderBy"))
 	sortDirection := SortDirection(r.FormValue("orderDirection"))
 
+	// Неизвестная категория игнорируется, поиск идёт по всем
+	var categories []torrent.Category
+	categoryName := r.FormValue("category")
+	if category, err := torrent.ParseCategory(categoryName); err == nil {
+		categories = []torrent.Category{category}
+	} else {
+		categoryName = ""
+	}
+
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
 	templateData := TemplateData{
 		Query:          query,
 		OrderBy:        sortBy,
-		OrderDirection: sortDirection}
+		OrderDirection: sortDirection,
+		Category:       categoryName,
+		Categories:     torrent.Categories(),
+		Page:           page}
 
 	if query == "" {
 		w.Header().Set("Content-Type", "text/html")
@@ -92,13 +235,35 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	torrents, err := db.SearchTorrentsByTitle(query, sortBy, sortDirection)
+	total, err := db.CountTorrentsByTitle(query, categories, searchMaxCount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pageSize := config.Main.SearchPageSize
+	pageCount := (total + pageSize - 1) / pageSize
+
+	// Страница за пределами результатов заменяется последней
+	if page > pageCount {
+		page = pageCount
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	torrents, err := db.SearchTorrentsByTitle(query, categories, sortBy, sortDirection, pageSize, (page-1)*pageSize)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	templateData.List = torrents
+	templateData.Total = total
+	templateData.TotalIsMax = total >= searchMaxCount
+	templateData.Page = page
+	templateData.PageCount = pageCount
+	templateData.Pages = pageNumbers(page, pageCount)
 
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
@@ -106,6 +271,44 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 	templates.ExecuteTemplate(w, "search.html", templateData)
 }
 
+// pageNumbers возвращает номера страниц для навигации вокруг текущей
+func pageNumbers(page, pageCount int) []int {
+	const window = 5
+
+	from := page - window
+	if from < 1 {
+		from = 1
+	}
+
+	to := page + window
+	if to > pageCount {
+		to = pageCount
+	}
+
+	var pages []int
+	for i := from; i <= to; i++ {
+		pages = append(pages, i)
+	}
+
+	return pages
+}
+
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	type TemplateData = struct {
+		Jobs []JobStatus
+	}
+
+	var templateData TemplateData
+	if scheduler != nil {
+		templateData.Jobs = scheduler.Status()
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+
+	templates.ExecuteTemplate(w, "admin.html", templateData)
+}
+
 func rootHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.RequestURI[1:] {
 	case "", "index.html", "index.htm":
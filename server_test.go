@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+func TestPageNumbers(t *testing.T) {
+	tests := []struct {
+		page      int
+		pageCount int
+		expected  []int
+	}{
+		{1, 0, nil},
+		{1, 1, []int{1}},
+		{1, 3, []int{1, 2, 3}},
+		{1, 20, []int{1, 2, 3, 4, 5, 6}},
+		{10, 20, []int{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+		{20, 20, []int{15, 16, 17, 18, 19, 20}},
+		{30, 20, nil}, // страница за пределами результатов
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, pageNumbers(test.page, test.pageCount), "%d of %d", test.page, test.pageCount)
+	}
+}
+
+func TestSearchHandlerPages(t *testing.T) {
+	newTestDb(t)
+	config.Main.SearchPageSize = 2
+
+	var err error
+	templates, err = template.New("").Funcs(templateFuncs).ParseGlob("site/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id := 1; id <= 5; id++ {
+		insertTestTorrent(t, testSourceID, id, fmt.Sprintf("Movie %d", id), byte(id), torrent.CategoryMovies)
+	}
+
+	w := serveTestRequest(searchHandler, "/search?query=movie&page=2")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.String()
+	assert.Contains(t, body, "Найдено: 5")
+	assert.Contains(t, body, "<b>2</b>")
+	assert.Contains(t, body, "page=1")
+	assert.Contains(t, body, "page=3")
+	assert.NotContains(t, body, "page=4")
+
+	// Новые торренты идут первыми, на второй странице - третий и четвёртый по счёту
+	assert.Contains(t, body, "Movie 3</a>")
+	assert.Contains(t, body, "Movie 2</a>")
+	assert.NotContains(t, body, "Movie 1</a>")
+	assert.NotContains(t, body, "Movie 4</a>")
+
+	// Страница за пределами результатов заменяется последней
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"/search?query=movie&page=100", "Movie 1</a>"},
+		{"/search?query=movie&page=-1", "Movie 5</a>"},
+		{"/search?query=movie&page=abc", "Movie 5</a>"},
+	}
+
+	for _, test := range tests {
+		w := serveTestRequest(searchHandler, test.target)
+		assert.Equal(t, http.StatusOK, w.Code, test.target)
+		assert.Contains(t, w.Body.String(), test.expected, test.target)
+	}
+
+	w = serveTestRequest(searchHandler, "/search?query=movie&page=100")
+	body = w.Body.String()
+	assert.Contains(t, body, "<b>3</b>")
+	assert.NotContains(t, body, "page=100")
+	assert.NotContains(t, body, "page=4")
+}
+
+// writeTestCertificate создаёт самоподписанный сертификат для 127.0.0.1
+// и возвращает пути к файлам сертификата и ключа
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "torrentdb test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour)}
+	cert, err := x509.CreateCertificate(rand.Reader, certTemplate, certTemplate, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyData, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyData}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+// newTestServerConfig задаёт настройки сервера для тестов
+// и останавливает запущенные тестом серверы по его завершении
+func newTestServerConfig(t *testing.T, listen ...string) {
+	config = new(Config)
+	config.ApplyDefaults()
+	config.Server.Listen = listen
+	config.Server.ShutdownTimeout.Duration = time.Second
+
+	servers = nil
+	t.Cleanup(func() {
+		stopServer()
+		servers = nil
+	})
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	newTestServerConfig(t)
+
+	tlsConfig, err := serverTLSConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	config.Server.TLSCert, config.Server.TLSKey = writeTestCertificate(t)
+	tlsConfig, err = serverTLSConfig()
+	if assert.NoError(t, err) && assert.NotNil(t, tlsConfig) {
+		assert.Len(t, tlsConfig.Certificates, 1)
+		assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+		assert.Equal(t, []string{"h2", "http/1.1"}, tlsConfig.NextProtos)
+	}
+
+	config.Server.TLSKey = filepath.Join(filepath.Dir(config.Server.TLSKey), "missing.pem")
+	_, err = serverTLSConfig()
+	assert.Error(t, err)
+
+	// Сервер не запускается с неверным сертификатом
+	assert.Error(t, startServers(http.NotFoundHandler()))
+	assert.Empty(t, servers)
+}
+
+// freeTestAddr возвращает свободный локальный адрес для сервера
+func freeTestAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func TestStartServers(t *testing.T) {
+	tests := []struct {
+		scheme string
+		tls    bool
+	}{
+		{"http", false},
+		{"https", true},
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	})
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	for _, test := range tests {
+		newTestServerConfig(t, freeTestAddr(t), freeTestAddr(t))
+		if test.tls {
+			config.Server.TLSCert, config.Server.TLSKey = writeTestCertificate(t)
+		}
+
+		if !assert.NoError(t, startServers(handler), test.scheme) {
+			continue
+		}
+		assert.Len(t, servers, 2, test.scheme)
+
+		// Каждый адрес из Listen обслуживается своим сервером
+		for _, addr := range config.Server.Listen {
+			resp, err := client.Get(test.scheme + "://" + addr + "/")
+			if !assert.NoError(t, err, addr) {
+				continue
+			}
+			b, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.NoError(t, err, addr)
+			assert.Equal(t, addr, string(b), addr)
+			assert.Equal(t, test.tls, resp.TLS != nil, addr)
+		}
+
+		stopServer()
+		servers = nil
+	}
+}
+
+func TestStartServersListenError(t *testing.T) {
+	addr := freeTestAddr(t)
+	newTestServerConfig(t, addr, addr)
+
+	// Второй сервер не может занять тот же адрес
+	assert.Error(t, startServers(http.NotFoundHandler()))
+	assert.Len(t, servers, 1)
+}
+
+func TestStopServerTimeout(t *testing.T) {
+	newTestServerConfig(t, freeTestAddr(t))
+	config.Server.ShutdownTimeout.Duration = 200 * time.Millisecond
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	if !assert.NoError(t, startServers(handler)) {
+		return
+	}
+
+	go http.Get("http://" + config.Server.Listen[0] + "/")
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request did not start")
+	}
+
+	// Зависший запрос не задерживает остановку дольше ShutdownTimeout
+	start := time.Now()
+	stopServer()
+	elapsed := time.Since(start)
+
+	assert.True(t, elapsed >= 200*time.Millisecond, elapsed)
+	assert.True(t, elapsed < 5*time.Second, elapsed)
+}
@@ -3,14 +3,68 @@ package main
 type SortField string
 
 const (
-	FieldName SortField = "name"
-	FieldSize SortField = "size"
-	FieldTime SortField = "time"
+	FieldName    SortField = "name"
+	FieldSize    SortField = "size"
+	FieldTime    SortField = "time"
+	FieldSeeders SortField = "seeders"
 )
 
+func (sortField SortField) IsValid() bool {
+	switch sortField {
+	case FieldName, FieldSize, FieldTime, FieldSeeders:
+		return true
+	}
+
+	return false
+}
+
 type SortDirection string
 
 const (
 	SortDirectionAsc  SortDirection = "asc"
 	SortDirectionDesc SortDirection = "desc"
 )
+
+func (sortDirection SortDirection) IsValid() bool {
+	switch sortDirection {
+	case SortDirectionAsc, SortDirectionDesc:
+		return true
+	}
+
+	return false
+}
+
+// orderBy возвращает выражение ORDER BY для таблицы info
+func orderBy(sortField SortField, sortDirection SortDirection) string {
+	var sql string
+
+	switch sortField {
+	case FieldName:
+		sql = " ORDER BY title"
+	case FieldSize:
+		sql = " ORDER BY size"
+	case FieldTime:
+		sql = " ORDER BY publication_time"
+	case FieldSeeders:
+		sql = " ORDER BY " + seedersExpr
+	default:
+		sortField = FieldTime
+		sql = " ORDER BY publication_time"
+	}
+
+	switch sortDirection {
+	case SortDirectionAsc, SortDirectionDesc:
+		sql += " " + string(sortDirection)
+	default:
+		if sortField == FieldTime || sortField == FieldSeeders {
+			sql += " " + string(SortDirectionDesc)
+		} else {
+			sql += " " + string(SortDirectionAsc)
+		}
+	}
+
+	// Однозначный порядок для постраничного вывода
+	sql += ", source_id, topic_id"
+
+	return sql
+}
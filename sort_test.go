@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		sortField     SortField
+		sortDirection SortDirection
+		expected      string
+	}{
+		{FieldName, SortDirectionAsc, " ORDER BY title asc, source_id, topic_id"},
+		{FieldSize, SortDirectionDesc, " ORDER BY size desc, source_id, topic_id"},
+		{FieldTime, SortDirectionAsc, " ORDER BY publication_time asc, source_id, topic_id"},
+		{FieldSeeders, SortDirectionAsc, " ORDER BY " + seedersExpr + " asc, source_id, topic_id"},
+
+		// Направление по умолчанию
+		{FieldName, "", " ORDER BY title asc, source_id, topic_id"},
+		{FieldSize, "", " ORDER BY size asc, source_id, topic_id"},
+		{FieldTime, "", " ORDER BY publication_time desc, source_id, topic_id"},
+		{FieldSeeders, "", " ORDER BY " + seedersExpr + " desc, source_id, topic_id"},
+
+		// Недопустимые значения не попадают в запрос
+		{"title; DROP TABLE info", "", " ORDER BY publication_time desc, source_id, topic_id"},
+		{FieldName, "asc; DROP TABLE info", " ORDER BY title asc, source_id, topic_id"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, orderBy(test.sortField, test.sortDirection), "%s %s", test.sortField, test.sortDirection)
+	}
+}
+
+func TestSearchTorrentsOrder(t *testing.T) {
+	newTestDb(t)
+
+	insertTestTorrent(t, 1, 3, "Movie b", 1, 0)
+	insertTestTorrent(t, 1, 1, "Movie c", 2, 0)
+	insertTestTorrent(t, 1, 2, "Movie a", 3, 0)
+
+	tests := []struct {
+		sortField     SortField
+		sortDirection SortDirection
+		expected      []int
+	}{
+		{FieldName, "", []int{2, 3, 1}},
+		{FieldSize, SortDirectionDesc, []int{3, 2, 1}},
+		{FieldTime, "", []int{3, 2, 1}},
+	}
+
+	for _, test := range tests {
+		torrents, err := db.SearchTorrentsByTitle("movie", nil, test.sortField, test.sortDirection, 10, 0)
+		assert.NoError(t, err)
+
+		var ids []int
+		for _, result := range torrents {
+			ids = append(ids, result.TopicID)
+		}
+		assert.Equal(t, test.expected, ids, "%s %s", test.sortField, test.sortDirection)
+	}
+
+	// Постраничный вывод
+	torrents, err := db.SearchTorrentsByTitle("movie", nil, FieldName, "", 1, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, torrents, 1) {
+		assert.Equal(t, 3, torrents[0].TopicID)
+	}
+}
@@ -0,0 +1,54 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Ошибки получения торрентов, возвращаемые драйверами.
+// Драйверы могут дополнять их подробностями, проверка выполняется через errors.Is.
+var (
+	// Тема отсутствует на источнике
+	ErrNotFound = errors.New("torrent not found")
+
+	// Тема удалена, закрыта или поглощена другой темой
+	ErrDeleted = errors.New("torrent deleted")
+
+	// Доступ к теме запрещён или требует авторизации
+	ErrAccessDenied = errors.New("access denied")
+
+	// Источник ограничил частоту запросов
+	ErrRateLimited = errors.New("rate limited")
+
+	// Страница получена, но не разобрана
+	ErrParseFailed = errors.New("parse failed")
+
+	// Временная ошибка источника, запрос стоит повторить позже
+	ErrTransient = errors.New("temporary source error")
+)
+
+// CheckResponse возвращает ошибку, соответствующую коду неуспешного ответа
+func CheckResponse(resp *http.Response) error {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusGone:
+		return ErrDeleted
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %s", ErrAccessDenied, resp.Status)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w: %s", ErrTransient, resp.Status)
+	}
+
+	return fmt.Errorf("unexpected status: %s", resp.Status)
+}
+
+// ParseError помечает ошибку разбора страницы или ответа API
+func ParseError(err error) error {
+	return fmt.Errorf("%w: %v", ErrParseFailed, err)
+}
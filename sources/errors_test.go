@@ -0,0 +1,46 @@
+package sources
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		expected   error
+	}{
+		{http.StatusOK, nil},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusGone, ErrDeleted},
+		{http.StatusUnauthorized, ErrAccessDenied},
+		{http.StatusForbidden, ErrAccessDenied},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusInternalServerError, ErrTransient},
+		{http.StatusBadGateway, ErrTransient}}
+
+	for _, test := range tests {
+		resp := &http.Response{StatusCode: test.statusCode, Status: http.StatusText(test.statusCode)}
+
+		err := CheckResponse(resp)
+		if test.expected == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.True(t, errors.Is(err, test.expected), "status %d: %v", test.statusCode, err)
+		}
+	}
+
+	err := CheckResponse(&http.Response{StatusCode: http.StatusTeapot, Status: "418 I'm a teapot"})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrNotFound))
+}
+
+func TestParseError(t *testing.T) {
+	err := ParseError(errors.New("title not found"))
+
+	assert.True(t, errors.Is(err, ErrParseFailed))
+	assert.Contains(t, err.Error(), "title not found")
+}
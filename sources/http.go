@@ -0,0 +1,241 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Задержка перед первым повтором запроса, каждая следующая в два раза больше
+var retryBaseDelay = time.Second
+
+// Максимальная задержка повтора, в том числе заданная заголовком Retry-After
+const retryMaxDelay = 5 * time.Minute
+
+var (
+	limiters      = make(map[string]*rateLimiter)
+	limitersMutex sync.Mutex
+)
+
+// NewHTTPClient создаёт HTTP-клиент источника. Запросы всех клиентов одного
+// источника ограничиваются общим лимитом RequestsPerSecond, при ответах
+// 429/5xx и сетевых таймаутах повторяются до MaxRetries раз. Если заданы
+// зеркала, запросы к недоступному адресу отправляются на следующее зеркало.
+func NewHTTPClient(options Options) (*http.Client, error) {
+	httpTransport := http.DefaultTransport
+
+	if options.ProxyAddr != "" && options.ProxyAddr != ProxyDirect {
+		dialer, err := proxy.SOCKS5("tcp", options.ProxyAddr, nil, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+
+		httpTransport = &http.Transport{Dial: dialer.Dial}
+	}
+
+	transport, err := newMirrorTransport(&fetchTransport{
+		base:       httpTransport,
+		limiter:    sourceLimiter(options.name, options.RequestsPerSecond),
+		timeout:    options.Timeout,
+		maxRetries: options.MaxRetries,
+		userAgent:  options.UserAgent}, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// sourceLimiter возвращает общий для источника ограничитель частоты запросов
+func sourceLimiter(name string, requestsPerSecond float64) *rateLimiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+
+	limitersMutex.Lock()
+	defer limitersMutex.Unlock()
+
+	interval := time.Duration(float64(time.Second) / requestsPerSecond)
+
+	limiter := limiters[name]
+	if limiter == nil {
+		limiter = new(rateLimiter)
+		limiters[name] = limiter
+	}
+	limiter.setInterval(interval)
+
+	return limiter
+}
+
+// Ограничитель, равномерно распределяющий запросы во времени
+type rateLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (limiter *rateLimiter) setInterval(interval time.Duration) {
+	limiter.mutex.Lock()
+	limiter.interval = interval
+	limiter.mutex.Unlock()
+}
+
+// Wait ожидает своей очереди на выполнение запроса
+func (limiter *rateLimiter) Wait() {
+	limiter.mutex.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(limiter.interval)
+	limiter.mutex.Unlock()
+
+	time.Sleep(delay)
+}
+
+type fetchTransport struct {
+	base       http.RoundTripper
+	limiter    *rateLimiter
+	timeout    time.Duration
+	maxRetries int
+	userAgent  string
+}
+
+func (transport *fetchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := transport.roundTrip(req)
+
+		retry, delay := shouldRetry(resp, err)
+		if !retry || attempt >= transport.maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if delay <= 0 {
+			delay = backoff(attempt)
+		}
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// roundTrip выполняет одну попытку запроса с учётом лимита и таймаута
+func (transport *fetchTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if transport.limiter != nil {
+		transport.limiter.Wait()
+	}
+
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if transport.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, transport.timeout)
+	}
+
+	// RoundTripper не должен изменять исходный запрос
+	attemptReq := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		attemptReq.Body = body
+	}
+	if transport.userAgent != "" && attemptReq.Header.Get("User-Agent") == "" {
+		attemptReq.Header.Set("User-Agent", transport.userAgent)
+	}
+
+	resp, err := transport.base.RoundTrip(attemptReq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Таймаут действует и на чтение тела ответа
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// shouldRetry сообщает, нужно ли повторить запрос, и задержку из Retry-After
+func shouldRetry(resp *http.Response, err error) (bool, time.Duration) {
+	if err != nil {
+		var netErr net.Error
+		return errors.As(err, &netErr) && netErr.Timeout(), 0
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+
+	return false, 0
+}
+
+// parseRetryAfter разбирает значение Retry-After в секундах или в виде даты,
+// при отсутствии или ошибке разбора возвращается 0
+func parseRetryAfter(s string, now time.Time) time.Duration {
+	if s == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(s); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(s); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+// backoff возвращает экспоненциальную задержку со случайным отклонением ±50%.
+// Задержка удваивается не дальше retryMaxDelay, чтобы не переполнить time.Duration.
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 0; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)))
+}
+
+// Тело ответа, отменяющее контекст запроса при закрытии
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+
+	return err
+}
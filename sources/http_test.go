@@ -0,0 +1,192 @@
+package sources
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	retryBaseDelay = time.Millisecond
+}
+
+func TestHTTPClientRetry(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		assert.Equal(t, "torrentdb-test", r.UserAgent())
+		assert.Equal(t, "1", r.FormValue("t"))
+
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(Options{MaxRetries: 3, UserAgent: "torrentdb-test"})
+	assert.NoError(t, err)
+
+	resp, err := client.PostForm(server.URL, url.Values{"t": {"1"}})
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(b))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestHTTPClientRetryExhausted(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(Options{MaxRetries: 2})
+	assert.NoError(t, err)
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestHTTPClientNoRetryOnNotFound(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(Options{MaxRetries: 2})
+	assert.NoError(t, err)
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Адрес, на котором заведомо нет прокси
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		proxyAddr string
+		direct    bool
+	}{
+		{"", true},
+		{ProxyDirect, true},
+		{closedAddr, false},
+	}
+
+	for _, test := range tests {
+		client, err := NewHTTPClient(Options{ProxyAddr: test.proxyAddr})
+		if !assert.NoError(t, err, test.proxyAddr) {
+			continue
+		}
+
+		resp, err := client.Get(server.URL)
+		if !test.direct {
+			assert.Error(t, err, test.proxyAddr)
+			continue
+		}
+
+		if assert.NoError(t, err, test.proxyAddr) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, test.proxyAddr)
+		}
+	}
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(Options{Timeout: 20 * time.Millisecond, MaxRetries: 1})
+	assert.NoError(t, err)
+
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestHTTPClientRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// Клиенты одного источника используют общий лимит
+	options := Options{RequestsPerSecond: 20, name: "ratelimit-test"}
+	client1, err := NewHTTPClient(options)
+	assert.NoError(t, err)
+	client2, err := NewHTTPClient(options)
+	assert.NoError(t, err)
+
+	start := time.Now()
+	for _, client := range []*http.Client{client1, client2, client1, client2, client1} {
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+}
+
+func TestBackoff(t *testing.T) {
+	for _, attempt := range []int{0, 1, 10, 34, 64, 1000} {
+		delay := backoff(attempt)
+		assert.True(t, delay > 0, "%d: %v", attempt, delay)
+		assert.True(t, delay < retryMaxDelay*3/2, "%d: %v", attempt, delay)
+	}
+
+	assert.True(t, backoff(1000) >= retryMaxDelay/2)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		s        string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"Mon, 01 Jun 2020 12:00:30 GMT", 30 * time.Second},
+		{"Mon, 01 Jun 2020 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, parseRetryAfter(test.s, now), test.s)
+	}
+}
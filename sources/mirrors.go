@@ -0,0 +1,231 @@
+package sources
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Адрес сайта вместе с зеркалами. Запросы к любому из адресов отправляются
+// на текущее зеркало, при его недоступности выбирается следующее по списку.
+type mirrorGroup struct {
+	mutex   sync.Mutex
+	urls    []*url.URL // первым идёт основной адрес
+	current int
+}
+
+func newMirrorGroup(baseURL string, mirrors []string) (*mirrorGroup, error) {
+	group := new(mirrorGroup)
+
+	for _, s := range append([]string{baseURL}, mirrors...) {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("mirror %q: %v", s, err)
+		}
+
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("mirror %q: expected http(s)://host[:port] address", s)
+		}
+
+		group.urls = append(group.urls, u)
+	}
+
+	return group, nil
+}
+
+// contains сообщает, относится ли адрес к сайту группы
+func (group *mirrorGroup) contains(u *url.URL) bool {
+	for _, mirror := range group.urls {
+		if strings.EqualFold(mirror.Host, u.Host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (group *mirrorGroup) currentIndex() int {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	return group.current
+}
+
+// setCurrent запоминает доступное зеркало для следующих запросов
+func (group *mirrorGroup) setCurrent(index int) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	if group.current != index {
+		log.Printf("Switching to mirror %s", group.urls[index].Host)
+		group.current = index
+	}
+}
+
+type mirrorTransport struct {
+	base   http.RoundTripper
+	groups []*mirrorGroup
+}
+
+// newMirrorTransport возвращает base без изменений, если зеркала не заданы
+func newMirrorTransport(base http.RoundTripper, options Options) (http.RoundTripper, error) {
+	transport := &mirrorTransport{base: base}
+
+	for _, v := range []struct {
+		baseURL string
+		mirrors []string
+	}{
+		{options.BaseURL, options.Mirrors},
+		{options.APIURL, options.APIMirrors}} {
+		if len(v.mirrors) == 0 {
+			continue
+		}
+
+		if v.baseURL == "" {
+			return nil, fmt.Errorf("mirrors %v are set without base URL", v.mirrors)
+		}
+
+		group, err := newMirrorGroup(v.baseURL, v.mirrors)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.groups = append(transport.groups, group)
+	}
+
+	if len(transport.groups) == 0 {
+		return base, nil
+	}
+
+	return transport, nil
+}
+
+func (transport *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var group *mirrorGroup
+	for _, v := range transport.groups {
+		if v.contains(req.URL) {
+			group = v
+			break
+		}
+	}
+	if group == nil {
+		return transport.base.RoundTrip(req)
+	}
+
+	start := group.currentIndex()
+
+	var lastErr error
+	for i := 0; i < len(group.urls); i++ {
+		index := (start + i) % len(group.urls)
+		mirror := group.urls[index]
+
+		mirrorReq, err := withMirror(req, mirror)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := transport.base.RoundTrip(mirrorReq)
+		if err == nil {
+			group.setCurrent(index)
+			restoreHost(resp, mirror, group.urls[0])
+			resp.Request = req
+
+			return resp, nil
+		}
+
+		// Запрос отменён вызывающей стороной или его тело нельзя отправить повторно
+		if req.Context().Err() != nil || (req.Body != nil && req.GetBody == nil) {
+			return nil, err
+		}
+
+		log.Printf("Mirror %s is unreachable: %v", mirror.Host, err)
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// withMirror возвращает копию запроса, направленную на зеркало
+func withMirror(req *http.Request, mirror *url.URL) (*http.Request, error) {
+	mirrorReq := req.Clone(req.Context())
+	mirrorReq.URL.Scheme = mirror.Scheme
+	mirrorReq.URL.Host = mirror.Host
+	mirrorReq.Host = ""
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		mirrorReq.Body = body
+	}
+
+	return mirrorReq, nil
+}
+
+// restoreHost заменяет адрес зеркала в перенаправлениях и cookie ответа на основной,
+// чтобы сессия и ссылки не зависели от выбранного зеркала
+func restoreHost(resp *http.Response, mirror, primary *url.URL) {
+	if mirror == primary {
+		return
+	}
+
+	if location, err := resp.Location(); err == nil && strings.EqualFold(location.Host, mirror.Host) {
+		location.Scheme = primary.Scheme
+		location.Host = primary.Host
+		resp.Header.Set("Location", location.String())
+	}
+
+	cookies := resp.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+
+	// Cookie с доменом зеркала сохраняются как cookie основного адреса
+	resp.Header.Del("Set-Cookie")
+	for _, cookie := range cookies {
+		cookie.Domain = ""
+		resp.Header.Add("Set-Cookie", cookie.String())
+	}
+}
+
+// TrimSiteName удаляет из заголовка страницы имя сайта, которое зеркала добавляют
+// в начало ("new-rutor.org :: Название") или в конец ("Название :: RuTracker.org")
+func TrimSiteName(title string) string {
+	const separator = " :: "
+
+	if p := strings.Index(title, separator); p >= 0 && isSiteName(title[:p]) {
+		title = title[p+len(separator):]
+	}
+
+	if p := strings.LastIndex(title, separator); p >= 0 && isSiteName(title[p+len(separator):]) {
+		title = title[:p]
+	}
+
+	return strings.TrimSpace(title)
+}
+
+// isSiteName сообщает, похожа ли строка на доменное имя: без пробелов,
+// с доменом верхнего уровня из латинских букв
+func isSiteName(s string) bool {
+	p := strings.LastIndex(s, ".")
+	if p <= 0 || strings.ContainsAny(s, " \t/") {
+		return false
+	}
+
+	tld := s[p+1:]
+	if len(tld) < 2 {
+		return false
+	}
+
+	for _, r := range tld {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,92 @@
+package sources
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClientMirrors(t *testing.T) {
+	// Адрес остановленного сервера недоступен
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	var requests int
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if r.URL.Path == "/login" {
+			assert.Equal(t, "1", r.FormValue("t"))
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/", Domain: "127.0.0.1"})
+			http.Redirect(w, r, "http://"+r.Host+"/index", http.StatusFound)
+			return
+		}
+
+		cookie, err := r.Cookie("session")
+		assert.NoError(t, err)
+		assert.Equal(t, "abc", cookie.Value)
+	}))
+	defer mirror.Close()
+
+	client, err := NewHTTPClient(Options{BaseURL: unreachable.URL, Mirrors: []string{"http://127.0.0.1:1", mirror.URL}})
+	assert.NoError(t, err)
+	client.Jar, err = cookiejar.New(nil)
+	assert.NoError(t, err)
+
+	resp, err := client.PostForm(unreachable.URL+"/login", url.Values{"t": {"1"}})
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Перенаправление и cookie относятся к основному адресу
+	assert.Equal(t, unreachable.URL+"/index", resp.Request.URL.String())
+	baseURL, _ := url.Parse(unreachable.URL)
+	assert.Len(t, client.Jar.Cookies(baseURL), 1)
+	assert.Equal(t, 2, requests)
+
+	// Доступное зеркало запоминается
+	transport := client.Transport.(*mirrorTransport)
+	assert.Equal(t, 2, transport.groups[0].currentIndex())
+}
+
+func TestHTTPClientMirrorsUnreachable(t *testing.T) {
+	client, err := NewHTTPClient(Options{BaseURL: "http://127.0.0.1:1", Mirrors: []string{"http://127.0.0.1:2"}})
+	assert.NoError(t, err)
+
+	_, err = client.Get("http://127.0.0.1:1/")
+	assert.Error(t, err)
+}
+
+func TestHTTPClientMirrorsValidation(t *testing.T) {
+	_, err := NewHTTPClient(Options{Mirrors: []string{"http://example.com"}})
+	assert.Error(t, err)
+
+	_, err = NewHTTPClient(Options{BaseURL: "http://example.com", Mirrors: []string{"example.org"}})
+	assert.Error(t, err)
+
+	_, err = NewHTTPClient(Options{BaseURL: "http://example.com", Mirrors: []string{"http://example.org/forum/"}})
+	assert.Error(t, err)
+}
+
+func TestTrimSiteName(t *testing.T) {
+	tests := []struct {
+		title    string
+		expected string
+	}{
+		{"new-rutor.org :: Фильм (2020)", "Фильм (2020)"},
+		{"rutor.info :: Фильм (2020)", "Фильм (2020)"},
+		{"Сериал [1-12 из 12] :: RuTracker.org", "Сериал [1-12 из 12]"},
+		{"Фильм :: Часть 2", "Фильм :: Часть 2"},
+		{"Программа v1.2 :: Portable", "Программа v1.2 :: Portable"},
+		{"1.5 :: Альбом", "1.5 :: Альбом"},
+		{"RuTracker.org", "RuTracker.org"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, TrimSiteName(test.title), test.title)
+	}
+}
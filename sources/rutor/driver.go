@@ -1,6 +1,8 @@
 package rutor
 
 import (
+	"fmt"
+
 	"github.com/nxshock/torrentdb/sources"
 )
 
@@ -8,8 +10,17 @@ type driver struct{}
 
 var driverInterface = new(driver)
 
-func (driver *driver) Open(proxyUrl string) (sources.Source, error) {
-	return newParser(proxyUrl)
+func (driver *driver) NewOptions() sources.DriverOptions {
+	return &sources.Options{BaseURL: defaultBaseUrl}
+}
+
+func (driver *driver) Open(options sources.DriverOptions) (sources.Source, error) {
+	rutorOptions, ok := options.(*sources.Options)
+	if !ok {
+		return nil, fmt.Errorf("unexpected options type %T", options)
+	}
+
+	return newParser(*rutorOptions)
 }
 
 func init() {
@@ -14,31 +14,36 @@ import (
 
 	md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/PuerkitoBio/goquery"
-	"golang.org/x/net/proxy"
 
+	"github.com/nxshock/torrentdb/sources"
 	"github.com/nxshock/torrentdb/torrent"
 )
 
-const maxIDUrl = "http://new-rutor.org"
-const urlMask = "http://new-rutor.org/torrent/%d"
+// Адрес сайта по умолчанию
+const defaultBaseUrl = "http://new-rutor.org"
+
+const urlMask = "/torrent/%d"
+const filesUrlMask = "/descriptions/%d.files"
 
 type Parser struct {
 	httpClient *http.Client
-}
 
-func newParser(socksProxyAddress string) (*Parser, error) {
-	httpTransport := http.DefaultTransport
+	// Адрес сайта без завершающего слеша
+	baseUrl string
+}
 
-	if socksProxyAddress != "" {
-		dialer, err := proxy.SOCKS5("tcp", socksProxyAddress, nil, proxy.Direct)
-		if err != nil {
-			return nil, err
-		}
+func newParser(options sources.Options) (*Parser, error) {
+	options.BaseURL = strings.TrimSuffix(options.BaseURL, "/")
+	if options.BaseURL == "" {
+		options.BaseURL = defaultBaseUrl
+	}
 
-		httpTransport = &http.Transport{Dial: dialer.Dial}
+	httpClient, err := sources.NewHTTPClient(options)
+	if err != nil {
+		return nil, err
 	}
 
-	parser := &Parser{httpClient: &http.Client{Transport: httpTransport}}
+	parser := &Parser{httpClient: httpClient, baseUrl: options.BaseURL}
 
 	return parser, nil
 }
@@ -48,13 +53,28 @@ func (parser *Parser) ID() int {
 }
 
 func (parser *Parser) MaxTorrentID() (int, error) {
-	resp, err := parser.httpClient.Get(maxIDUrl)
+	resp, err := parser.httpClient.Get(parser.baseUrl)
 	if err != nil {
 		return 0, err
 	}
 	defer resp.Body.Close()
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	err = sources.CheckResponse(resp)
+	if err != nil {
+		return 0, err
+	}
+
+	maxID, err := parseMaxID(resp.Body)
+	if err != nil {
+		return 0, sources.ParseError(err)
+	}
+
+	return maxID, nil
+}
+
+// parseMaxID возвращает максимальный ID торрента среди ссылок главной страницы
+func parseMaxID(r io.Reader) (int, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
 	if err != nil {
 		return 0, err
 	}
@@ -67,6 +87,9 @@ func (parser *Parser) MaxTorrentID() (int, error) {
 				maxID = id
 			}
 		})
+	if maxID == 0 {
+		return 0, errors.New("no torrents found on index page")
+	}
 
 	return maxID, nil
 }
@@ -75,61 +98,132 @@ func (parser *Parser) Name() string {
 	return "Rutor"
 }
 
+func (parser *Parser) TopicURL(id int) string {
+	return parser.baseUrl + fmt.Sprintf(urlMask, id)
+}
+
 func (parser *Parser) GetTorrentByID(id int) (*torrent.Torrent, error) {
-	resp, err := parser.httpClient.Get(fmt.Sprintf(urlMask, id))
+	resp, err := parser.httpClient.Get(parser.TopicURL(id))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	err = sources.CheckResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("topic %d: %w", id, err)
+	}
+
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
+	exists, err := parseExists(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
+	}
+	if !exists {
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ErrNotFound)
+	}
+
 	title, err := parseTitle(bytes.NewReader(b))
 	if err != nil {
-		return nil, fmt.Errorf("%d: %v", id, err)
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
 	}
 
 	body, err := parseBody(bytes.NewReader(b))
 	if err != nil {
-		return nil, fmt.Errorf("%d: %v", id, err)
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
 	}
 
 	magnet, err := parseMagnet(bytes.NewReader(b))
 	if err != nil {
-		return nil, fmt.Errorf("%d: %v", id, err)
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
 	}
 
 	publicationTime, err := parsePublicationTime(bytes.NewReader(b))
 	if err != nil {
-		return nil, fmt.Errorf("%d: %v", id, err)
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
 	}
 
 	size, err := parseSize(bytes.NewReader(b))
 	if err != nil {
-		return nil, fmt.Errorf("%d: %v", id, err)
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
+	}
+
+	stats, err := parseStats(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
+	}
+
+	category, err := parseCategory(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
+	}
+
+	files, err := parser.getFiles(id)
+	if err != nil {
+		return nil, fmt.Errorf("topic %d: files: %w", id, err)
 	}
 
 	torrent := &torrent.Torrent{
-		Title:           title,
-		Body:            template.HTML(body),
-		Btih:            magnet,
-		PublicationTime: publicationTime,
-		Size:            size}
+		Title:            title,
+		Body:             template.HTML(body),
+		Btih:             magnet.InfoHash,
+		PublicationTime:  publicationTime,
+		Size:             size,
+		Category:         categories[category],
+		SourceCategoryID: category,
+		Stats:            *stats,
+		Files:            files,
+		Trackers:         magnet.Trackers}
 
 	return torrent, nil
 }
 
+// getFiles загружает список файлов торрента
+func (parser *Parser) getFiles(id int) ([]torrent.File, error) {
+	resp, err := parser.httpClient.Get(parser.baseUrl + fmt.Sprintf(filesUrlMask, id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = sources.CheckResponse(resp)
+	// Страница темы уже получена, поэтому раздача без списка файлов сохраняется без него
+	if errors.Is(err, sources.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	files, err := parseFiles(resp.Body)
+	if err != nil {
+		return nil, sources.ParseError(err)
+	}
+
+	return files, nil
+}
+
+// parseExists проверяет наличие на странице таблицы с описанием торрента.
+// Для отсутствующих и удалённых раздач сайт отдаёт страницу без неё.
+func parseExists(r io.Reader) (bool, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return false, err
+	}
+
+	return doc.Find("table#details").Length() > 0, nil
+}
+
 func parseTitle(r io.Reader) (string, error) {
 	doc, err := goquery.NewDocumentFromReader(r)
 	if err != nil {
 		return "", err
 	}
 
-	title := doc.Find("html > head > title").First().Text()
-	title = strings.TrimPrefix(title, "new-rutor.org :: ")
+	title := sources.TrimSiteName(doc.Find("html > head > title").First().Text())
 
 	return title, nil
 }
@@ -153,7 +247,7 @@ func parseBody(r io.Reader) (string, error) {
 	//return body, nil
 }
 
-func parseMagnet(r io.Reader) ([]byte, error) {
+func parseMagnet(r io.Reader) (*torrent.MagnetLink, error) {
 	doc, err := goquery.NewDocumentFromReader(r)
 	if err != nil {
 		return nil, err
@@ -168,8 +262,11 @@ func parseMagnet(r io.Reader) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if magnet.InfoHash == nil {
+		return nil, errors.New("no btih in magnet link")
+	}
 
-	return magnet.UrnHash, nil
+	return &magnet, nil
 }
 
 func parsePublicationTime(r io.Reader) (time.Time, error) {
@@ -192,12 +289,13 @@ func parsePublicationTime(r io.Reader) (time.Time, error) {
 		return time.Time{}, errors.New("time not found")
 	}
 
-	p := strings.Index(timeStr, "  ")
-	if p < 0 {
+	// Дата и время могут сопровождаться относительным временем вида "(8 часов назад)"
+	fields := strings.Fields(timeStr)
+	if len(fields) < 2 {
 		return time.Time{}, fmt.Errorf("unexpected time format: %s", timeStr)
 	}
 
-	return time.ParseInLocation("02-01-2006 15:04:05", timeStr[:p], time.Local)
+	return time.ParseInLocation("2-1-2006 15:04:05", fields[0]+" "+fields[1], time.Local)
 }
 
 func parseSize(r io.Reader) (uint64, error) {
@@ -233,6 +331,181 @@ func parseSize(r io.Reader) (uint64, error) {
 	return f, nil
 }
 
+// GetStats получает статистику раздач со страниц торрентов.
+// Торренты, страницы которых не удалось получить, пропускаются.
+func (parser *Parser) GetStats(ids []int) (map[int]*torrent.Stats, error) {
+	stats := make(map[int]*torrent.Stats)
+
+	var lastErr error
+	for _, id := range ids {
+		s, err := parser.getStats(id)
+		if err != nil {
+			lastErr = fmt.Errorf("topic %d: %v", id, err)
+			continue
+		}
+
+		stats[id] = s
+	}
+
+	if len(stats) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	return stats, nil
+}
+
+func (parser *Parser) getStats(id int) (*torrent.Stats, error) {
+	resp, err := parser.httpClient.Get(parser.TopicURL(id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = sources.CheckResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := parseStats(resp.Body)
+	if err != nil {
+		return nil, sources.ParseError(err)
+	}
+
+	return stats, nil
+}
+
+// parseStats разбирает кол-во раздающих и качающих.
+// Кол-во скачиваний сайт не показывает.
+func parseStats(r io.Reader) (*torrent.Stats, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var seedersStr, leechersStr string
+	doc.Find("table#details > tbody > tr").Each(
+		func(i int, s *goquery.Selection) {
+			switch s.Find("td:nth-child(1)").Text() {
+			case "Раздают":
+				seedersStr = strings.TrimSpace(s.Find("td:nth-child(2)").Text())
+			case "Качают":
+				leechersStr = strings.TrimSpace(s.Find("td:nth-child(2)").Text())
+			}
+		})
+	if seedersStr == "" || leechersStr == "" {
+		return nil, errors.New("stats not found")
+	}
+
+	seeders, err := strconv.Atoi(seedersStr)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected seeders format: %s", seedersStr)
+	}
+
+	leechers, err := strconv.Atoi(leechersStr)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected leechers format: %s", leechersStr)
+	}
+
+	return &torrent.Stats{Seeders: seeders, Leechers: leechers, UpdateTime: time.Now()}, nil
+}
+
+// Соответствие категорий сайта общим категориям
+var categories = map[int]torrent.Category{
+	1:  torrent.CategoryMovies,   // Зарубежные фильмы
+	2:  torrent.CategoryMusic,    // Музыка
+	3:  torrent.CategoryOther,    // Другое
+	4:  torrent.CategoryTV,       // Зарубежные сериалы
+	5:  torrent.CategoryMovies,   // Наши фильмы
+	6:  torrent.CategoryTV,       // Телевизор
+	7:  torrent.CategoryMovies,   // Мультипликация
+	8:  torrent.CategoryGames,    // Игры
+	9:  torrent.CategorySoftware, // Софт
+	10: torrent.CategoryTV,       // Аниме
+	11: torrent.CategoryBooks,    // Книги
+	12: torrent.CategoryMovies,   // Научно-популярные фильмы
+	13: torrent.CategoryOther,    // Спорт и Здоровье
+	15: torrent.CategoryOther,    // Юмор
+	16: torrent.CategoryOther,    // Хозяйство и Быт
+	17: torrent.CategoryOther}    // Иностранные релизы
+
+// parseCategory возвращает ID категории сайта из ссылки вида /browse/0/<ID>/0/0.
+// Если категория не указана, возвращается 0.
+func parseCategory(r io.Reader) (int, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var href string
+	doc.Find("table#details > tbody > tr").EachWithBreak(
+		func(i int, s *goquery.Selection) bool {
+			if s.Find("td:nth-child(1)").Text() == "Категория" {
+				href = s.Find("td:nth-child(2) > a").AttrOr("href", "")
+				return false
+			}
+
+			return true
+		})
+
+	fields := strings.Split(strings.Trim(href, "/"), "/")
+	if len(fields) < 3 || fields[0] != "browse" {
+		return 0, nil
+	}
+
+	category, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return 0, fmt.Errorf("unexpected category link: %s", href)
+	}
+
+	return category, nil
+}
+
+// parseFiles разбирает таблицу со списком файлов вида
+// <tr><td>путь</td><td>1.5&nbsp;GB (1610612736)</td></tr>
+func parseFiles(r io.Reader) ([]torrent.File, error) {
+	// Сайт отдаёт только строки таблицы, без обёртки они отбрасываются HTML-парсером
+	r = io.MultiReader(strings.NewReader("<table>"), r, strings.NewReader("</table>"))
+
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []torrent.File
+	doc.Find("tr").EachWithBreak(
+		func(i int, s *goquery.Selection) bool {
+			// Заголовок таблицы
+			if s.Find("td.header").Length() > 0 {
+				return true
+			}
+
+			path := strings.TrimSpace(s.Find("td:nth-child(1)").Text())
+			sizeStr := s.Find("td:nth-child(2)").Text()
+
+			start := strings.LastIndex(sizeStr, "(")
+			end := strings.LastIndex(sizeStr, ")")
+			if start < 0 || end < start {
+				err = fmt.Errorf("unexpected file size format: %s", sizeStr)
+				return false
+			}
+
+			var size uint64
+			size, err = strconv.ParseUint(sizeStr[start+1:end], 10, 64)
+			if err != nil {
+				return false
+			}
+
+			files = append(files, torrent.File{Path: path, Size: size})
+
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
 func getTorrentIDFromURL(s string) int {
 	s = strings.TrimPrefix(s, "/torrent/")
 	if p := strings.Index(s, "/"); p < 0 {
@@ -1,19 +1,141 @@
 package rutor
 
 import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/sources"
+	"github.com/nxshock/torrentdb/sources/sourcetest"
+	"github.com/nxshock/torrentdb/torrent"
 )
 
 func TestParserMaxTorrentID(t *testing.T) {
-	parser, err := newParser("192.168.0.2:9050")
+	server := sourcetest.NewServer()
+	defer server.Close()
+	server.Handle("/", sourcetest.Response{File: "testdata/index.html"})
+
+	parser, err := newParser(sources.Options{BaseURL: server.URL})
 	assert.NoError(t, err)
 
 	maxID, err := parser.MaxTorrentID()
 	assert.NoError(t, err)
+	assert.Equal(t, 758940, maxID)
+}
+
+func TestParserGetTorrentByID(t *testing.T) {
+	server := sourcetest.NewServer()
+	defer server.Close()
+	server.Handle("/torrent/758938", sourcetest.Response{File: "testdata/topic.html"})
+	server.Handle("/descriptions/758938.files", sourcetest.Response{File: "testdata/files.html"})
+
+	parser, err := newParser(sources.Options{BaseURL: server.URL})
+	assert.NoError(t, err)
+
+	torrent, err := parser.GetTorrentByID(758938)
+	assert.NoError(t, err)
+
+	// Время публикации разбирается в локальном часовом поясе,
+	// для эталонного файла сохраняются только показания часов
+	pt := torrent.PublicationTime
+	torrent.PublicationTime = time.Date(pt.Year(), pt.Month(), pt.Day(), pt.Hour(), pt.Minute(), pt.Second(), 0, time.UTC)
+	torrent.Stats.UpdateTime = time.Time{}
+	sourcetest.Golden(t, "torrent", torrent)
+
+	assert.Equal(t, server.URL+"/torrent/758938", parser.TopicURL(758938))
+}
+
+func TestParserMirrors(t *testing.T) {
+	// Адрес остановленного сервера недоступен
+	unreachable := sourcetest.NewServer()
+	unreachable.Close()
+
+	server := sourcetest.NewServer()
+	defer server.Close()
+	server.Handle("/torrent/758938", sourcetest.Response{File: "testdata/topic_mirror.html"})
+	server.Handle("/descriptions/758938.files", sourcetest.Response{File: "testdata/files.html"})
+
+	parser, err := newParser(sources.Options{BaseURL: unreachable.URL, Mirrors: []string{server.URL}})
+	assert.NoError(t, err)
+
+	torrent, err := parser.GetTorrentByID(758938)
+	assert.NoError(t, err)
+	assert.Equal(t, "Фильм / Movie (2020) WEB-DL 720p от MegaPeer | D", torrent.Title)
+	assert.Len(t, torrent.Files, 2)
+
+	// Ссылки на темы ведут на основной адрес
+	assert.Equal(t, unreachable.URL+"/torrent/758938", parser.TopicURL(758938))
+}
+
+func TestParserErrors(t *testing.T) {
+	server := sourcetest.NewServer()
+	defer server.Close()
+	server.Handle("/torrent/1", sourcetest.Response{File: "testdata/notfound.html"})
+	server.Handle("/torrent/3", sourcetest.Response{StatusCode: http.StatusServiceUnavailable})
+	server.Handle("/torrent/4", sourcetest.Response{StatusCode: http.StatusForbidden})
+	server.Handle("/torrent/5", sourcetest.Response{File: "testdata/topic_no_size.html"})
+
+	parser, err := newParser(sources.Options{BaseURL: server.URL})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		id       int
+		expected error
+	}{
+		{1, sources.ErrNotFound},     // страница удалённой раздачи
+		{2, sources.ErrNotFound},     // ответ 404
+		{3, sources.ErrTransient},    // ответ 503
+		{4, sources.ErrAccessDenied}, // ответ 403
+		{5, sources.ErrParseFailed},  // нет размера
+	}
+
+	for _, test := range tests {
+		_, err := parser.GetTorrentByID(test.id)
+		if assert.True(t, errors.Is(err, test.expected), "%d: %v", test.id, err) {
+			assert.Contains(t, err.Error(), fmt.Sprintf("topic %d:", test.id))
+		}
+	}
+}
+
+func TestParserGetTorrentWithoutFiles(t *testing.T) {
+	server := sourcetest.NewServer()
+	defer server.Close()
+	server.Handle("/torrent/758938", sourcetest.Response{File: "testdata/topic.html"})
+
+	parser, err := newParser(sources.Options{BaseURL: server.URL})
+	assert.NoError(t, err)
 
-	assert.True(t, maxID > 0)
+	torrent, err := parser.GetTorrentByID(758938)
+	assert.NoError(t, err)
+	assert.Equal(t, "Фильм / Movie (2020) WEB-DL 720p от MegaPeer | D", torrent.Title)
+	assert.Empty(t, torrent.Files)
+}
+
+func TestParserGetStats(t *testing.T) {
+	server := sourcetest.NewServer()
+	defer server.Close()
+	server.Handle("/torrent/758938", sourcetest.Response{File: "testdata/topic.html"})
+
+	parser, err := newParser(sources.Options{BaseURL: server.URL})
+	assert.NoError(t, err)
+
+	stats, err := parser.GetStats([]int{758938, 758939})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, 39, stats[758938].Seeders)
+
+	_, err = parser.GetStats([]int{758939})
+	assert.Error(t, err)
 }
 
 func TestGetTorrentIDFromURL(t *testing.T) {
@@ -30,3 +152,145 @@ func TestGetTorrentIDFromURL(t *testing.T) {
 		assert.Equal(t, test.expectedID, gotID)
 	}
 }
+
+func TestParseFiles(t *testing.T) {
+	f, err := os.Open("testdata/files.html")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	files, err := parseFiles(f)
+	assert.NoError(t, err)
+
+	expected := []torrent.File{
+		{Path: "Movie.2020.WEB-DL.720p/Movie.2020.WEB-DL.720p.mkv", Size: 4692571234},
+		{Path: "Movie.2020.WEB-DL.720p/Subs/Rus.srt", Size: 87162},
+	}
+	assert.Equal(t, expected, files)
+}
+
+func TestParseCategory(t *testing.T) {
+	f, err := os.Open("testdata/category.html")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	category, err := parseCategory(f)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, category)
+	assert.Equal(t, torrent.CategoryTV, categories[category])
+}
+
+func TestParseStats(t *testing.T) {
+	f, err := os.Open("testdata/stats.html")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	stats, err := parseStats(f)
+	assert.NoError(t, err)
+	assert.Equal(t, 39, stats.Seeders)
+	assert.Equal(t, 2, stats.Leechers)
+	assert.False(t, stats.UpdateTime.IsZero())
+}
+
+func TestParseMagnet(t *testing.T) {
+	f, err := os.Open("testdata/magnet.html")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	magnet, err := parseMagnet(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "55fcd06474e50f49003f7e93681763afaa4d506d", hex.EncodeToString(magnet.InfoHash))
+	assert.Equal(t, []string{"udp://opentor.net:6969", "http://retracker.local/announce"}, magnet.Trackers)
+}
+
+func TestParseExists(t *testing.T) {
+	tests := []struct {
+		fileName string
+		expected bool
+	}{
+		{"testdata/category.html", true},
+		{"testdata/notfound.html", false},
+	}
+
+	for _, test := range tests {
+		f, err := os.Open(test.fileName)
+		assert.NoError(t, err)
+
+		exists, err := parseExists(f)
+		f.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, exists, test.fileName)
+	}
+}
+
+// Результаты разбора страницы темы всеми функциями разбора
+type topicPage struct {
+	Exists          interface{}
+	Title           interface{}
+	Body            interface{}
+	Magnet          interface{}
+	PublicationTime interface{}
+	Size            interface{}
+	Stats           interface{}
+	Category        interface{}
+}
+
+// TestParseTopicGolden сравнивает результаты разбора записанных страниц с эталонными
+func TestParseTopicGolden(t *testing.T) {
+	fileNames := []string{
+		"testdata/topic.html",          // обычная тема
+		"testdata/topic_no_size.html",  // нет размера
+		"testdata/topic_odd_date.html", // дата без ведущих нулей и относительного времени
+		"testdata/topic_hostile.html",  // скрипты, ссылки javascript: и некорректные значения
+		"testdata/topic_mirror.html",   // имя зеркала в заголовке
+		"testdata/notfound.html",       // удалённая тема
+	}
+
+	for _, fileName := range fileNames {
+		b, err := ioutil.ReadFile(fileName)
+		assert.NoError(t, err)
+
+		page := topicPage{
+			Exists:   sourcetest.Result(parseExists(bytes.NewReader(b))),
+			Title:    sourcetest.Result(parseTitle(bytes.NewReader(b))),
+			Body:     sourcetest.Result(parseBody(bytes.NewReader(b))),
+			Size:     sourcetest.Result(parseSize(bytes.NewReader(b))),
+			Category: sourcetest.Result(parseCategory(bytes.NewReader(b)))}
+
+		if magnet, err := parseMagnet(bytes.NewReader(b)); err == nil {
+			page.Magnet = map[string]interface{}{"InfoHash": hex.EncodeToString(magnet.InfoHash), "Trackers": magnet.Trackers}
+		} else {
+			page.Magnet = sourcetest.Result(nil, err)
+		}
+
+		if publicationTime, err := parsePublicationTime(bytes.NewReader(b)); err == nil {
+			page.PublicationTime = publicationTime.Format("2006-01-02 15:04:05")
+		} else {
+			page.PublicationTime = sourcetest.Result(nil, err)
+		}
+
+		if stats, err := parseStats(bytes.NewReader(b)); err == nil {
+			stats.UpdateTime = time.Time{}
+			page.Stats = stats
+		} else {
+			page.Stats = sourcetest.Result(nil, err)
+		}
+
+		sourcetest.Golden(t, strings.TrimSuffix(filepath.Base(fileName), ".html"), page)
+	}
+}
+
+func TestParseFilesGolden(t *testing.T) {
+	f, err := os.Open("testdata/files.html")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	sourcetest.Golden(t, "files", sourcetest.Result(parseFiles(f)))
+}
+
+func TestParseMaxIDGolden(t *testing.T) {
+	f, err := os.Open("testdata/index.html")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	sourcetest.Golden(t, "index", sourcetest.Result(parseMaxID(f)))
+}
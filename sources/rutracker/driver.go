@@ -1,15 +1,48 @@
 package rutracker
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/nxshock/torrentdb/sources"
 )
 
+// Параметры источника
+type Options struct {
+	sources.Options
+
+	// Учётные данные пользователя сайта, пустые значения - без авторизации
+	Login    string
+	Password string
+
+	// Путь к файлу для сохранения cookie сессии между запусками,
+	// по умолчанию rutracker.cookies в каталоге DataDir
+	CookieFile string
+}
+
+func (options *Options) Validate() error {
+	if (options.Login == "") != (options.Password == "") {
+		return errors.New("both login and password must be set")
+	}
+
+	return options.Options.Validate()
+}
+
 type driver struct{}
 
 var driverInterface = new(driver)
 
-func (driver *driver) Open(proxyUrl string) (sources.Source, error) {
-	return newParser(proxyUrl)
+func (driver *driver) NewOptions() sources.DriverOptions {
+	return &Options{Options: sources.Options{BaseURL: defaultBaseUrl, APIURL: defaultApiUrl}}
+}
+
+func (driver *driver) Open(options sources.DriverOptions) (sources.Source, error) {
+	rutrackerOptions, ok := options.(*Options)
+	if !ok {
+		return nil, fmt.Errorf("unexpected options type %T", options)
+	}
+
+	return newParser(*rutrackerOptions)
 }
 
 func init() {
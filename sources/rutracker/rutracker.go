@@ -6,41 +6,99 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"html/template"
 	"io"
-	"io/ioutil"
+	"log"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/PuerkitoBio/goquery"
-	"golang.org/x/net/proxy"
 	"golang.org/x/text/encoding/charmap"
 
+	"github.com/nxshock/torrentdb/sources"
 	"github.com/nxshock/torrentdb/torrent"
 )
 
-const urlMask = "https://rutracker.org/forum/viewtopic.php?t=%d"
+// Адреса сайта и API по умолчанию
+const defaultBaseUrl = "https://rutracker.org"
+const defaultApiUrl = "http://api.rutracker.org"
+
+const urlMask = "viewtopic.php?t=%d"
+const filesUrl = "viewtorrent.php"
+
+// Раздачи трекера, отсортированные по убыванию времени регистрации
+const trackerUrl = "tracker.php?o=1&s=2"
 
 type Parser struct {
 	httpClient *http.Client
+
+	// Адрес форума с завершающим слешем и адрес API без него
+	forumURL *url.URL
+	apiUrl   string
+
+	// Учётные данные и файл cookie сессии, пустой login - работа без авторизации
+	login       string
+	password    string
+	cookieFile  string
+	sessionLock sync.Mutex
+
+	// Категории разделов форума, загружаются при первом обращении.
+	// После ошибки загрузки следующая попытка выполняется не раньше forumCategoriesRetry.
+	forumCategories      map[int]torrent.Category
+	forumCategoriesRetry time.Time
+	forumCategoriesLock  sync.Mutex
 }
 
-func newParser(socksProxyAddress string) (*Parser, error) {
-	httpTransport := http.DefaultTransport
+func newParser(options Options) (*Parser, error) {
+	options.BaseURL = strings.TrimSuffix(options.BaseURL, "/")
+	if options.BaseURL == "" {
+		options.BaseURL = defaultBaseUrl
+	}
 
-	if socksProxyAddress != "" {
-		dialer, err := proxy.SOCKS5("tcp", socksProxyAddress, nil, proxy.Direct)
-		if err != nil {
-			return nil, err
-		}
+	options.APIURL = strings.TrimSuffix(options.APIURL, "/")
+	if options.APIURL == "" {
+		options.APIURL = defaultApiUrl
+	}
 
-		httpTransport = &http.Transport{Dial: dialer.Dial}
+	forumURL, err := url.Parse(options.BaseURL + "/forum/")
+	if err != nil {
+		return nil, err
 	}
 
-	parser := &Parser{httpClient: &http.Client{Transport: httpTransport}}
+	if options.CookieFile == "" && options.DataDir != "" {
+		options.CookieFile = filepath.Join(options.DataDir, "rutracker.cookies")
+	}
+
+	httpClient, err := sources.NewHTTPClient(options.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient.Jar, err = cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &Parser{
+		httpClient: httpClient,
+		forumURL:   forumURL,
+		apiUrl:     options.APIURL,
+		login:      options.Login,
+		password:   options.Password,
+		cookieFile: options.CookieFile}
+
+	err = parser.loadCookies()
+	if err != nil {
+		return nil, fmt.Errorf("load cookies: %v", err)
+	}
 
 	return parser, nil
 }
@@ -53,36 +111,137 @@ func (parser *Parser) Name() string {
 	return "RuTracker"
 }
 
+func (parser *Parser) TopicURL(id int) string {
+	return parser.forumPageURL(fmt.Sprintf(urlMask, id))
+}
+
+// forumPageURL возвращает полный адрес страницы форума
+func (parser *Parser) forumPageURL(page string) string {
+	return parser.forumURL.String() + page
+}
+
 func (parser *Parser) GetTorrentByID(id int) (*torrent.Torrent, error) {
 	torrent, err := parser.getTorrentInfoFromApi(id)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := parser.httpClient.Get(fmt.Sprintf(urlMask, id))
+	unicodeBytes, err := parser.getForumPage(parser.TopicURL(id))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := parseBody(bytes.NewReader(unicodeBytes))
+	if err != nil {
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
+	}
+
+	torrent.Body = template.HTML(body)
+
+	torrent.Trackers, err = parseTrackers(bytes.NewReader(unicodeBytes))
+	if err != nil {
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
+	}
+
+	// Статистика не запрашивается для каждой темы: её загружает пакетами
+	// задание обновления статистики через GetStats
+
+	// Список файлов доступен только после входа на сайт, без него список
+	// остаётся неизвестным. Ошибка получения списка возвращается, чтобы тема
+	// была загружена повторно, а не сохранена с пустым списком.
+	if parser.login != "" {
+		torrent.Files, err = parser.getFiles(id)
+		if err != nil {
+			return nil, fmt.Errorf("topic %d: get files: %w", id, err)
+		}
+	}
+
+	return torrent, nil
+}
+
+// getFiles загружает список файлов торрента
+func (parser *Parser) getFiles(id int) ([]torrent.File, error) {
+	err := parser.ensureSession("")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := parser.httpClient.PostForm(parser.forumPageURL(filesUrl), url.Values{"t": {strconv.Itoa(id)}})
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	win1251Bytes, err := ioutil.ReadAll(resp.Body)
+	err = sources.CheckResponse(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	unicodeBytes, err := charmap.Windows1251.NewDecoder().Bytes(win1251Bytes)
+	files, err := parseFiles(charmap.Windows1251.NewDecoder().Reader(resp.Body))
+	if err != nil {
+		return nil, sources.ParseError(err)
+	}
+
+	return files, nil
+}
+
+// parseFiles разбирает дерево файлов вида
+// <ul class="ftree"><li class="dir"><div><b>папка</b><i>размер</i></div><ul>...</ul></li><li><b>файл</b><i>размер</i></li></ul>
+func parseFiles(r io.Reader) ([]torrent.File, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
 	if err != nil {
 		return nil, err
 	}
 
-	body, err := parseBody(bytes.NewReader(unicodeBytes))
+	root := doc.Find("ul.ftree").First()
+	if root.Length() == 0 {
+		return nil, errors.New("file tree not found")
+	}
+
+	var files []torrent.File
+	err = parseFileTree(root, "", &files)
 	if err != nil {
 		return nil, err
 	}
 
-	torrent.Body = template.HTML(body)
+	return files, nil
+}
 
-	return torrent, nil
+func parseFileTree(ul *goquery.Selection, dir string, files *[]torrent.File) error {
+	var err error
+	ul.ChildrenFiltered("li").EachWithBreak(func(i int, li *goquery.Selection) bool {
+		if li.HasClass("dir") {
+			name := li.ChildrenFiltered("div").ChildrenFiltered("b").First().Text()
+			err = parseFileTree(li.ChildrenFiltered("ul"), dir+name+"/", files)
+			return err == nil
+		}
+
+		name := li.ChildrenFiltered("b").First().Text()
+
+		var size uint64
+		size, err = parseFileSize(li.ChildrenFiltered("i").First().Text())
+		if err != nil {
+			return false
+		}
+
+		*files = append(*files, torrent.File{Path: dir + name, Size: size})
+
+		return true
+	})
+
+	return err
+}
+
+// parseFileSize разбирает размер файла в байтах с разделителями разрядов
+func parseFileSize(s string) (uint64, error) {
+	s = strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+
+	return strconv.ParseUint(s, 10, 64)
 }
 
 func parseTitle(r io.Reader) (string, error) {
@@ -91,8 +250,7 @@ func parseTitle(r io.Reader) (string, error) {
 		return "", err
 	}
 
-	title := doc.Find("html > head > title").First().Text()
-	title = strings.TrimSuffix(title, " :: RuTracker.org")
+	title := sources.TrimSiteName(doc.Find("html > head > title").First().Text())
 
 	return title, nil
 }
@@ -122,7 +280,14 @@ func parseBody(r io.Reader) (string, error) {
 
 	// Починка картинок
 	doc.Find("var.postImg").Each(func(i int, s *goquery.Selection) {
-		s.SetHtml(fmt.Sprintf(`<img src="%s">`, s.AttrOr("title", "")))
+		s.Empty()
+
+		src, err := url.Parse(s.AttrOr("title", ""))
+		if err != nil || (src.Scheme != "http" && src.Scheme != "https") {
+			return
+		}
+
+		s.AppendHtml(`<img src="` + html.EscapeString(src.String()) + `">`)
 	})
 
 	//html, _ := doc.Find("table#topic_main div.post_body").First().Html()
@@ -132,72 +297,335 @@ func parseBody(r io.Reader) (string, error) {
 	return markdown, nil
 }
 
-// TODO: без регистрации на сайте не работает, требуется альтернативный алгоритм
-func (parser *Parser) MaxTorrentID() (int, error) {
-	type Resp struct {
-		Result map[int][]int
+// parseTrackers возвращает адреса трекеров из magnet-ссылки на странице темы.
+// Если ссылки нет, возвращается пустой список.
+func parseTrackers(r io.Reader) ([]string, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
 	}
 
-	const url = "http://api.rutracker.org/v1/static/forum_size"
+	href, exists := doc.Find("a.magnet-link").First().Attr("href")
+	if !exists {
+		return nil, nil
+	}
 
-	resp, err := parser.httpClient.Get(url)
+	magnet, err := torrent.ParseMagnet(href)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var jResp Resp
-	err = json.NewDecoder(resp.Body).Decode(&jResp)
+	return magnet.Trackers, nil
+}
+
+// ID последней раздачи, используемый без входа на сайт. Раздачи
+// с большими ID в этом случае не загружаются.
+const anonymousMaxTopicID = 5943785
+
+// MaxTorrentID возвращает ID последней зарегистрированной раздачи
+// со страницы трекера, которая доступна только после входа на сайт
+func (parser *Parser) MaxTorrentID() (int, error) {
+	if parser.login == "" {
+		log.Printf("Rutracker login is not set, using topic ID %d as the latest one", anonymousMaxTopicID)
+		return anonymousMaxTopicID, nil
+	}
+
+	b, err := parser.getForumPage(parser.forumPageURL(trackerUrl))
 	if err != nil {
 		return 0, err
 	}
 
-	var maxID int
-	for _, group := range jResp.Result {
-		maxID += group[0]
+	maxID, err := parseMaxTopicID(bytes.NewReader(b))
+	if err != nil {
+		return 0, sources.ParseError(err)
 	}
 
-	return 5943785, nil
+	return maxID, nil
 }
 
-func (parser *Parser) getTorrentInfoFromApi(id int) (*torrent.Torrent, error) {
-	type ApiResp struct {
-		Result map[int]*struct {
-			InfoHash   string  `json:"info_hash"`
-			ForumID    int     `json:"forum_id"`
-			Size       float64 `json:"size"`
-			RegTime    int64   `json:"reg_time"`
-			TopicTitle string  `json:"topic_title"`
+// parseMaxTopicID возвращает максимальный ID темы среди ссылок на странице трекера
+func parseMaxTopicID(r io.Reader) (int, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var maxID int
+	doc.Find("a.tLink").Each(func(i int, s *goquery.Selection) {
+		u, err := url.Parse(s.AttrOr("href", ""))
+		if err != nil {
+			return
+		}
+
+		id, err := strconv.Atoi(u.Query().Get("t"))
+		if err == nil && id > maxID {
+			maxID = id
 		}
+	})
+	if maxID == 0 {
+		return 0, errors.New("no topics found on tracker page")
 	}
 
-	resp, err := parser.httpClient.Get("http://api.rutracker.org/v1/get_tor_topic_data?by=topic_id&val=" + strconv.Itoa(id))
+	return maxID, nil
+}
+
+func (parser *Parser) getTorrentInfoFromApi(id int) (*torrent.Torrent, error) {
+	resp, err := parser.httpClient.Get(parser.apiUrl + "/v1/get_tor_topic_data?by=topic_id&val=" + strconv.Itoa(id))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var apiResp ApiResp
-	err = json.NewDecoder(resp.Body).Decode(&apiResp)
+	err = sources.CheckResponse(resp)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("topic %d: %w", id, err)
+	}
+
+	topics, err := parseTopicData(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(err))
 	}
 
-	info := apiResp.Result[id]
+	info := topics[id]
 	if info == nil {
-		return nil, errors.New("no such torrent")
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ErrNotFound)
+	}
+
+	if deletedTorStatuses[info.TorStatus] {
+		return nil, fmt.Errorf("topic %d: %w (status %d)", id, sources.ErrDeleted, info.TorStatus)
+	}
+
+	if info.Size < 0 {
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(fmt.Errorf("negative size: %v", info.Size)))
 	}
 
 	urnHash, err := hex.DecodeString(info.InfoHash)
-	if info == nil {
-		return nil, fmt.Errorf("wrong urn hash: %v", err)
+	if err != nil {
+		return nil, fmt.Errorf("topic %d: %w", id, sources.ParseError(fmt.Errorf("wrong urn hash: %v", err)))
 	}
 
 	t := &torrent.Torrent{
-		Title:           info.TopicTitle,
-		Size:            uint64(info.Size),
-		PublicationTime: time.Unix(info.RegTime, 0),
-		Btih:            urnHash}
+		Title:            info.TopicTitle,
+		Size:             uint64(info.Size),
+		PublicationTime:  time.Unix(info.RegTime, 0),
+		Btih:             urnHash,
+		Category:         parser.forumCategory(info.ForumID),
+		SourceCategoryID: info.ForumID}
 
 	return t, nil
 }
+
+// Данные темы из ответа get_tor_topic_data
+type topicData struct {
+	InfoHash   string  `json:"info_hash"`
+	ForumID    int     `json:"forum_id"`
+	Size       float64 `json:"size"`
+	RegTime    int64   `json:"reg_time"`
+	TopicTitle string  `json:"topic_title"`
+	TorStatus  int     `json:"tor_status"`
+}
+
+// parseTopicData разбирает ответ get_tor_topic_data вида {"result": {"<ID>": {...}}},
+// отсутствующие темы имеют значение null
+func parseTopicData(r io.Reader) (map[int]*topicData, error) {
+	type Resp struct {
+		Result map[int]*topicData
+	}
+
+	var jResp Resp
+	err := json.NewDecoder(r).Decode(&jResp)
+	if err != nil {
+		return nil, err
+	}
+
+	return jResp.Result, nil
+}
+
+// Статусы раздач, при которых тема считается удалённой:
+// закрыто, повтор и поглощено
+var deletedTorStatuses = map[int]bool{1: true, 5: true, 7: true}
+
+// Максимальное кол-во ID в одном запросе к API
+const apiMaxIDCount = 100
+
+// GetStats получает статистику раздач через API
+func (parser *Parser) GetStats(ids []int) (map[int]*torrent.Stats, error) {
+	stats := make(map[int]*torrent.Stats)
+
+	for from := 0; from < len(ids); from += apiMaxIDCount {
+		to := from + apiMaxIDCount
+		if to > len(ids) {
+			to = len(ids)
+		}
+
+		idStrs := make([]string, 0, to-from)
+		for _, id := range ids[from:to] {
+			idStrs = append(idStrs, strconv.Itoa(id))
+		}
+
+		resp, err := parser.httpClient.Get(parser.apiUrl + "/v1/get_peer_stats?by=topic_id&val=" + strings.Join(idStrs, ","))
+		if err != nil {
+			return nil, err
+		}
+
+		err = sources.CheckResponse(resp)
+		if err == nil {
+			err = parsePeerStats(resp.Body, stats)
+			if err != nil {
+				err = sources.ParseError(err)
+			}
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// parsePeerStats разбирает ответ get_peer_stats вида
+// {"result": {"<ID>": [сиды, личи, время последнего сида]}}, отсутствующие темы имеют значение null.
+// Кол-во скачиваний API не возвращает.
+func parsePeerStats(r io.Reader, stats map[int]*torrent.Stats) error {
+	type Resp struct {
+		Result map[int][]int64
+	}
+
+	var jResp Resp
+	err := json.NewDecoder(r).Decode(&jResp)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for id, values := range jResp.Result {
+		if len(values) < 2 {
+			continue
+		}
+
+		stats[id] = &torrent.Stats{Seeders: int(values[0]), Leechers: int(values[1]), UpdateTime: now}
+	}
+
+	return nil
+}
+
+// Интервал между попытками загрузки дерева разделов после ошибки
+const forumTreeRetryDelay = time.Minute
+
+// forumCategory возвращает общую категорию раздела форума. Если дерево разделов
+// не удалось загрузить, ошибка записывается в журнал и возвращается CategoryOther,
+// чтобы недоступность дерева не мешала загрузке тем.
+func (parser *Parser) forumCategory(forumID int) torrent.Category {
+	parser.forumCategoriesLock.Lock()
+	forumCategories := parser.forumCategories
+	load := forumCategories == nil && !time.Now().Before(parser.forumCategoriesRetry)
+	if load {
+		// Остальные потоки не ждут загрузки и не запрашивают дерево одновременно
+		parser.forumCategoriesRetry = time.Now().Add(forumTreeRetryDelay)
+	}
+	parser.forumCategoriesLock.Unlock()
+
+	if load {
+		var err error
+		forumCategories, err = parser.getForumTree()
+		if err != nil {
+			log.Printf("Get rutracker forum tree error: %v", err)
+			return torrent.CategoryOther
+		}
+
+		parser.forumCategoriesLock.Lock()
+		parser.forumCategories = forumCategories
+		parser.forumCategoriesLock.Unlock()
+	}
+
+	return forumCategories[forumID]
+}
+
+// getForumTree загружает дерево разделов форума и определяет категории разделов
+func (parser *Parser) getForumTree() (map[int]torrent.Category, error) {
+	resp, err := parser.httpClient.Get(parser.apiUrl + "/v1/static/cat_forum_tree")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = sources.CheckResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	forumCategories, err := parseForumTree(resp.Body)
+	if err != nil {
+		return nil, sources.ParseError(err)
+	}
+
+	return forumCategories, nil
+}
+
+// parseForumTree разбирает дерево разделов форума и определяет категорию каждого раздела
+// по названиям самого раздела, родительского раздела и категории форума
+func parseForumTree(r io.Reader) (map[int]torrent.Category, error) {
+	type Resp struct {
+		Result struct {
+			Categories map[int]string        `json:"c"`
+			Forums     map[int]string        `json:"f"`
+			Tree       map[int]map[int][]int `json:"tree"`
+		}
+	}
+
+	var jResp Resp
+	err := json.NewDecoder(r).Decode(&jResp)
+	if err != nil {
+		return nil, err
+	}
+
+	forumCategories := make(map[int]torrent.Category)
+	for categoryID, forums := range jResp.Result.Tree {
+		categoryName := jResp.Result.Categories[categoryID]
+
+		for forumID, subforums := range forums {
+			forumName := jResp.Result.Forums[forumID]
+
+			forumCategories[forumID] = categoryByNames(forumName, categoryName)
+			for _, subforumID := range subforums {
+				forumCategories[subforumID] = categoryByNames(jResp.Result.Forums[subforumID], forumName, categoryName)
+			}
+		}
+	}
+
+	return forumCategories, nil
+}
+
+// Ключевые слова в названиях разделов в порядке проверки
+var categoryKeywords = []struct {
+	keyword  string
+	category torrent.Category
+}{
+	{"аудиокниг", torrent.CategoryAudiobooks},
+	{"сериал", torrent.CategoryTV},
+	{"аниме", torrent.CategoryTV},
+	{"кино", torrent.CategoryMovies},
+	{"фильм", torrent.CategoryMovies},
+	{"мульт", torrent.CategoryMovies},
+	{"музык", torrent.CategoryMusic},
+	{"книг", torrent.CategoryBooks},
+	{"журнал", torrent.CategoryBooks},
+	{"игр", torrent.CategoryGames},
+	{"программ", torrent.CategorySoftware},
+	{"операционн", torrent.CategorySoftware}}
+
+// categoryByNames возвращает категорию по первому из названий, содержащему ключевое слово
+func categoryByNames(names ...string) torrent.Category {
+	for _, name := range names {
+		name = strings.ToLower(name)
+
+		for _, v := range categoryKeywords {
+			if strings.Contains(name, v.keyword) {
+				return v.category
+			}
+		}
+	}
+
+	return torrent.CategoryOther
+}
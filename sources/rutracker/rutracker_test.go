@@ -1,14 +1,66 @@
 package rutracker
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/nxshock/torrentdb/sources"
+	"github.com/nxshock/torrentdb/sources/sourcetest"
+	"github.com/nxshock/torrentdb/torrent"
 )
 
+// newTestServer запускает сервер с ответами API и страницами темы 5896188
+func newTestServer() *sourcetest.Server {
+	server := sourcetest.NewServer()
+	server.Handle("/v1/get_tor_topic_data?by=topic_id&val=5896188", sourcetest.Response{File: "testdata/tor_topic_data.json"})
+	server.Handle("/v1/get_tor_topic_data?by=topic_id&val=5896189", sourcetest.Response{File: "testdata/tor_topic_data_deleted.json"})
+	server.Handle("/v1/get_tor_topic_data?by=topic_id&val=5896191", sourcetest.Response{File: "testdata/tor_topic_data_deleted.json"})
+	server.Handle("/v1/get_tor_topic_data?by=topic_id&val=5896193", sourcetest.Response{File: "testdata/tor_topic_data_hostile.json"})
+	server.Handle("/v1/get_peer_stats?by=topic_id&val=5896188", sourcetest.Response{File: "testdata/peer_stats.json"})
+	server.Handle("/v1/static/cat_forum_tree", sourcetest.Response{File: "testdata/cat_forum_tree.json"})
+	server.Handle("/forum/viewtopic.php?t=5896188", sourcetest.Response{File: "testdata/topic.html", Encoding: charmap.Windows1251})
+	server.Handle("/forum/viewtorrent.php?t=5896188", sourcetest.Response{File: "testdata/files.html", Encoding: charmap.Windows1251})
+	server.Handle("/forum/tracker.php?o=1&s=2", sourcetest.Response{File: "testdata/tracker.html", Encoding: charmap.Windows1251})
+
+	// Вход выполняется только с паролем "secret", при успешном входе выдаётся cookie сессии
+	server.HandleFunc("/forum/login.php", func(w http.ResponseWriter, r *http.Request) {
+		password, _ := charmap.Windows1251.NewDecoder().String(r.PostFormValue("login_password"))
+		if password != "secret" {
+			b, _ := ioutil.ReadFile("testdata/login_failed.html")
+			b, _ = charmap.Windows1251.NewEncoder().Bytes(b)
+			w.Write(b)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "session-1", Path: "/forum/"})
+		http.Redirect(w, r, "/forum/index.php", http.StatusFound)
+	})
+
+	return server
+}
+
+// testOptions возвращает параметры, направляющие запросы к сайту и API на сервер
+func testOptions(server *sourcetest.Server) Options {
+	return Options{Options: sources.Options{BaseURL: server.URL, APIURL: server.URL}}
+}
+
 func TestGetTorrentByIDFromApi(t *testing.T) {
-	parser, err := newParser("192.168.0.2:9050")
+	server := newTestServer()
+	defer server.Close()
+
+	parser, err := newParser(testOptions(server))
 	assert.NoError(t, err)
 
 	torrent, err := parser.getTorrentInfoFromApi(5896188)
@@ -18,4 +70,406 @@ func TestGetTorrentByIDFromApi(t *testing.T) {
 	assert.Equal(t, "55fcd06474e50f49003f7e93681763afaa4d506d", torrent.BtihHex())
 	assert.Equal(t, uint64(524722552), torrent.Size)
 	assert.Equal(t, "[Nintendo Switch] Dungeon of the Endless + Deep Freeze, Death Gamble, Rescue Team, Organic Matters [NSZ][ENG]", torrent.Title)
+	assert.Equal(t, 12, torrent.SourceCategoryID)
+}
+
+func TestParserGetTorrentByID(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	options := testOptions(server)
+	options.Login = "user"
+	options.Password = "secret"
+
+	parser, err := newParser(options)
+	assert.NoError(t, err)
+
+	torrent, err := parser.GetTorrentByID(5896188)
+	assert.NoError(t, err)
+
+	torrent.PublicationTime = torrent.PublicationTime.UTC()
+	sourcetest.Golden(t, "torrent", torrent)
+
+	// Статистика не запрашивается для каждой темы
+	assert.NotContains(t, server.Requests(), "GET /v1/get_peer_stats?by=topic_id&val=5896188")
+
+	assert.Equal(t, server.URL+"/forum/viewtopic.php?t=5896188", parser.TopicURL(5896188))
+}
+
+func TestParserGetTorrentFiles(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	// Без входа на сайт список файлов неизвестен и не запрашивается
+	parser, err := newParser(testOptions(server))
+	assert.NoError(t, err)
+
+	torrent, err := parser.GetTorrentByID(5896188)
+	assert.NoError(t, err)
+	assert.Nil(t, torrent.Files)
+	assert.NotContains(t, server.Requests(), "POST /forum/viewtorrent.php?t=5896188")
+
+	// Ошибка получения списка файлов не даёт сохранить тему без файлов
+	server.Handle("/forum/viewtorrent.php?t=5896188", sourcetest.Response{StatusCode: http.StatusBadGateway})
+
+	options := testOptions(server)
+	options.Login = "user"
+	options.Password = "secret"
+
+	parser, err = newParser(options)
+	assert.NoError(t, err)
+
+	_, err = parser.GetTorrentByID(5896188)
+	if assert.True(t, errors.Is(err, sources.ErrTransient), "%v", err) {
+		assert.Contains(t, err.Error(), "topic 5896188: get files:")
+	}
+}
+
+func TestParserForumCategory(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	server.Handle("/v1/static/cat_forum_tree", sourcetest.Response{StatusCode: http.StatusBadGateway})
+
+	parser, err := newParser(testOptions(server))
+	assert.NoError(t, err)
+
+	// Ошибка загрузки дерева разделов не мешает загрузке темы
+	result, err := parser.GetTorrentByID(5896188)
+	assert.NoError(t, err)
+	assert.Equal(t, torrent.CategoryOther, result.Category)
+
+	// До истечения интервала дерево повторно не запрашивается
+	requestCount := len(server.Requests())
+	assert.Equal(t, torrent.CategoryOther, parser.forumCategory(12))
+	assert.Len(t, server.Requests(), requestCount)
+
+	server.Handle("/v1/static/cat_forum_tree", sourcetest.Response{File: "testdata/cat_forum_tree.json"})
+	parser.forumCategoriesRetry = time.Time{}
+
+	assert.Equal(t, torrent.CategoryMovies, parser.forumCategory(12))
+	assert.Equal(t, torrent.CategoryOther, parser.forumCategory(999))
+}
+
+func TestParserGetStats(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	parser, err := newParser(testOptions(server))
+	assert.NoError(t, err)
+
+	stats, err := parser.GetStats([]int{5896188})
+	assert.NoError(t, err)
+	if assert.NotNil(t, stats[5896188]) {
+		assert.Equal(t, 12, stats[5896188].Seeders)
+		assert.Equal(t, 3, stats[5896188].Leechers)
+	}
+
+	_, err = parser.GetStats([]int{5896189})
+	assert.True(t, errors.Is(err, sources.ErrNotFound), "%v", err)
+}
+
+func TestParserErrors(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	server.Handle("/v1/get_tor_topic_data?by=topic_id&val=5896194", sourcetest.Response{StatusCode: http.StatusBadGateway})
+
+	parser, err := newParser(testOptions(server))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		id       int
+		expected error
+	}{
+		{5896189, sources.ErrNotFound},    // null в ответе API
+		{5896190, sources.ErrNotFound},    // ответ 404
+		{5896191, sources.ErrDeleted},     // раздача поглощена
+		{5896193, sources.ErrParseFailed}, // некорректные данные API
+		{5896194, sources.ErrTransient},   // ответ 502
+	}
+
+	for _, test := range tests {
+		_, err := parser.GetTorrentByID(test.id)
+		if assert.True(t, errors.Is(err, test.expected), "%d: %v", test.id, err) {
+			assert.Contains(t, err.Error(), fmt.Sprintf("topic %d:", test.id))
+		}
+	}
+}
+
+func TestParserLogIn(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	cookieFile := filepath.Join(t.TempDir(), "rutracker.cookies")
+
+	parser, err := newParser(testOptions(server))
+	assert.NoError(t, err)
+
+	// Без логина сайт не запрашивается
+	maxID, err := parser.MaxTorrentID()
+	assert.NoError(t, err)
+	assert.Equal(t, anonymousMaxTopicID, maxID)
+	assert.Empty(t, server.Requests())
+
+	options := testOptions(server)
+	options.Login = "пользователь"
+	options.Password = "wrong"
+
+	parser, err = newParser(options)
+	assert.NoError(t, err)
+
+	_, err = parser.MaxTorrentID()
+	assert.Equal(t, errLoginFailed, err)
+
+	options.Password = "secret"
+	options.CookieFile = cookieFile
+
+	parser, err = newParser(options)
+	assert.NoError(t, err)
+
+	maxID, err = parser.MaxTorrentID()
+	assert.NoError(t, err)
+	assert.Equal(t, 6012347, maxID)
+	assert.Equal(t, "session-1", parser.sessionID())
+
+	// Сохранённая сессия используется без повторного входа
+	parser, err = newParser(options)
+	assert.NoError(t, err)
+
+	requestCount := len(server.Requests())
+	_, err = parser.MaxTorrentID()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET /forum/tracker.php?o=1&s=2"}, server.Requests()[requestCount:])
+}
+
+func TestParseBodyHostileImages(t *testing.T) {
+	f, err := os.Open("testdata/hostile_topic.html")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	body, err := parseBody(f)
+	assert.NoError(t, err)
+
+	assert.NotContains(t, body, `onerror="`)
+	assert.NotContains(t, body, "javascript:")
+	assert.Contains(t, body, "https://example.com/ok.jpg")
+}
+
+func TestParseFiles(t *testing.T) {
+	f, err := os.Open("testdata/files.html")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	files, err := parseFiles(f)
+	assert.NoError(t, err)
+
+	expected := []torrent.File{
+		{Path: "Album (2020)/CD1/01. Intro.flac", Size: 12345000},
+		{Path: "Album (2020)/CD1/02. Song.flac", Size: 27500000},
+		{Path: "Album (2020)/cover.jpg", Size: 120},
+	}
+	assert.Equal(t, expected, files)
+}
+
+func TestParseForumTree(t *testing.T) {
+	f, err := os.Open("testdata/cat_forum_tree.json")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	forumCategories, err := parseForumTree(f)
+	assert.NoError(t, err)
+
+	expected := map[int]torrent.Category{
+		10: torrent.CategoryTV,
+		11: torrent.CategoryTV,
+		12: torrent.CategoryMovies,
+		20: torrent.CategoryAudiobooks,
+		21: torrent.CategoryAudiobooks,
+		22: torrent.CategoryBooks,
+		30: torrent.CategoryMusic,
+		31: torrent.CategoryMusic,
+		40: torrent.CategorySoftware,
+		41: torrent.CategorySoftware}
+	assert.Equal(t, expected, forumCategories)
+}
+
+func TestParsePeerStats(t *testing.T) {
+	f, err := os.Open("testdata/peer_stats.json")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	stats := make(map[int]*torrent.Stats)
+	err = parsePeerStats(f, stats)
+	assert.NoError(t, err)
+
+	assert.Len(t, stats, 2)
+	assert.Equal(t, 12, stats[5896188].Seeders)
+	assert.Equal(t, 3, stats[5896188].Leechers)
+	assert.Equal(t, 0, stats[5896190].Seeders)
+	assert.Nil(t, stats[5896189])
+}
+
+func TestParseTrackers(t *testing.T) {
+	f, err := os.Open("testdata/magnet_topic.html")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	trackers, err := parseTrackers(f)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://bt.t-ru.org/ann?magnet"}, trackers)
+}
+
+func TestParseMaxTopicID(t *testing.T) {
+	f, err := os.Open("testdata/tracker.html")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	maxID, err := parseMaxTopicID(f)
+	assert.NoError(t, err)
+	assert.Equal(t, 6012347, maxID)
+}
+
+func TestParseLoggedIn(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/tracker.html")
+	assert.NoError(t, err)
+	assert.True(t, parseLoggedIn(b))
+
+	b, err = ioutil.ReadFile("testdata/login_failed.html")
+	assert.NoError(t, err)
+	assert.False(t, parseLoggedIn(b))
+}
+
+func TestParseLoginError(t *testing.T) {
+	tests := []struct {
+		fileName string
+		expected error
+	}{
+		{"testdata/login_failed.html", errLoginFailed},
+		{"testdata/login_captcha.html", errCaptchaRequired},
+	}
+
+	for _, test := range tests {
+		f, err := os.Open(test.fileName)
+		assert.NoError(t, err)
+
+		assert.Equal(t, test.expected, parseLoginError(f), test.fileName)
+		f.Close()
+	}
+}
+
+func TestCookiesPersistence(t *testing.T) {
+	cookieFile := filepath.Join(t.TempDir(), "rutracker.cookies")
+
+	parser, err := newParser(Options{CookieFile: cookieFile})
+	assert.NoError(t, err)
+	assert.Equal(t, "", parser.sessionID())
+
+	parser.httpClient.Jar.SetCookies(parser.forumURL, []*http.Cookie{{Name: sessionCookieName, Value: "123-abc", Path: parser.forumURL.Path}})
+	assert.NoError(t, parser.saveCookies())
+
+	parser, err = newParser(Options{CookieFile: cookieFile})
+	assert.NoError(t, err)
+	assert.Equal(t, "123-abc", parser.sessionID())
+}
+
+// Результаты разбора страницы темы всеми функциями разбора
+type topicPage struct {
+	LoggedIn bool
+	Title    interface{}
+	Body     interface{}
+	Trackers interface{}
+}
+
+// TestParseTopicGolden сравнивает результаты разбора записанных страниц с эталонными
+func TestParseTopicGolden(t *testing.T) {
+	fileNames := []string{
+		"testdata/topic.html",         // обычная тема
+		"testdata/magnet_topic.html",  // тема без заголовка страницы
+		"testdata/topic_deleted.html", // удалённая тема
+		"testdata/hostile_topic.html", // картинки с обработчиками событий и ссылками javascript:
+		"testdata/tracker.html",       // страница трекера вместо темы
+	}
+
+	for _, fileName := range fileNames {
+		b, err := ioutil.ReadFile(fileName)
+		assert.NoError(t, err)
+
+		page := topicPage{
+			LoggedIn: parseLoggedIn(b),
+			Title:    sourcetest.Result(parseTitle(bytes.NewReader(b))),
+			Body:     sourcetest.Result(parseBody(bytes.NewReader(b))),
+			Trackers: sourcetest.Result(parseTrackers(bytes.NewReader(b)))}
+
+		sourcetest.Golden(t, strings.TrimSuffix(filepath.Base(fileName), ".html"), page)
+	}
+}
+
+func TestParseTopicDataGolden(t *testing.T) {
+	fileNames := []string{
+		"testdata/tor_topic_data.json",         // обычная раздача
+		"testdata/tor_topic_data_deleted.json", // поглощённая и отсутствующая раздачи
+		"testdata/tor_topic_data_odd.json",     // нет размера и времени регистрации
+		"testdata/tor_topic_data_hostile.json", // некорректные хеш, размер и время
+	}
+
+	for _, fileName := range fileNames {
+		f, err := os.Open(fileName)
+		assert.NoError(t, err)
+
+		sourcetest.Golden(t, strings.TrimSuffix(filepath.Base(fileName), ".json"), sourcetest.Result(parseTopicData(f)))
+		f.Close()
+	}
+}
+
+func TestParseGolden(t *testing.T) {
+	tests := []struct {
+		golden   string
+		fileName string
+		parse    func(io.Reader) (interface{}, error)
+	}{
+		{"files", "testdata/files.html", func(r io.Reader) (interface{}, error) { return parseFiles(r) }},
+		{"files_odd", "testdata/files_odd.html", func(r io.Reader) (interface{}, error) { return parseFiles(r) }},
+		{"cat_forum_tree", "testdata/cat_forum_tree.json", func(r io.Reader) (interface{}, error) { return parseForumTree(r) }},
+		{"max_topic_id", "testdata/tracker.html", func(r io.Reader) (interface{}, error) { return parseMaxTopicID(r) }},
+		{"max_topic_id_no_topics", "testdata/topic.html", func(r io.Reader) (interface{}, error) { return parseMaxTopicID(r) }},
+		{"login_failed", "testdata/login_failed.html", func(r io.Reader) (interface{}, error) { return nil, parseLoginError(r) }},
+		{"login_captcha", "testdata/login_captcha.html", func(r io.Reader) (interface{}, error) { return nil, parseLoginError(r) }},
+		{"peer_stats", "testdata/peer_stats.json", func(r io.Reader) (interface{}, error) {
+			stats := make(map[int]*torrent.Stats)
+			err := parsePeerStats(r, stats)
+			for _, s := range stats {
+				s.UpdateTime = time.Time{}
+			}
+			return stats, err
+		}},
+	}
+
+	for _, test := range tests {
+		f, err := os.Open(test.fileName)
+		assert.NoError(t, err)
+
+		value, err := test.parse(f)
+		f.Close()
+
+		sourcetest.Golden(t, test.golden, sourcetest.Result(value, err))
+	}
+}
+
+func TestOptions(t *testing.T) {
+	options := driverInterface.NewOptions().(*Options)
+	assert.Equal(t, defaultBaseUrl, options.BaseURL)
+	assert.NoError(t, options.Validate())
+
+	options.Login = "user"
+	assert.Error(t, options.Validate())
+
+	options.Password = "password"
+	options.RequestsPerSecond = -1
+	assert.Error(t, options.Validate())
+
+	// Файл cookie по умолчанию сохраняется в каталоге данных
+	options.RequestsPerSecond = 0
+	options.DataDir = t.TempDir()
+	parser, err := newParser(*options)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(options.DataDir, "rutracker.cookies"), parser.cookieFile)
 }
@@ -0,0 +1,224 @@
+package rutracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/nxshock/torrentdb/sources"
+)
+
+const loginUrl = "login.php"
+
+// Имя cookie с идентификатором сессии
+const sessionCookieName = "bb_session"
+
+// Ошибки входа относятся к ошибкам доступа
+var (
+	errLoginFailed     = fmt.Errorf("%w: rutracker login failed, check login and password", sources.ErrAccessDenied)
+	errCaptchaRequired = fmt.Errorf("%w: rutracker login requires captcha, log in with a browser from the same IP address and try again later", sources.ErrAccessDenied)
+)
+
+// sessionID возвращает идентификатор текущей сессии, пустой при её отсутствии
+func (parser *Parser) sessionID() string {
+	for _, cookie := range parser.httpClient.Jar.Cookies(parser.forumURL) {
+		if cookie.Name == sessionCookieName {
+			return cookie.Value
+		}
+	}
+
+	return ""
+}
+
+// ensureSession выполняет вход, если заданы учётные данные, а сессия отсутствует
+// или всё ещё равна устаревшей staleSession. Повторный вход из нескольких потоков
+// после истечения одной и той же сессии выполняется один раз.
+func (parser *Parser) ensureSession(staleSession string) error {
+	if parser.login == "" {
+		return nil
+	}
+
+	parser.sessionLock.Lock()
+	defer parser.sessionLock.Unlock()
+
+	if session := parser.sessionID(); session != "" && session != staleSession {
+		return nil
+	}
+
+	return parser.logIn()
+}
+
+func (parser *Parser) logIn() error {
+	encoder := charmap.Windows1251.NewEncoder()
+
+	login, err := encoder.String(parser.login)
+	if err != nil {
+		return err
+	}
+
+	password, err := encoder.String(parser.password)
+	if err != nil {
+		return err
+	}
+
+	submit, err := encoder.String("Вход")
+	if err != nil {
+		return err
+	}
+
+	// Устаревшая сессия не должна попасть в запрос
+	parser.httpClient.Jar.SetCookies(parser.forumURL, []*http.Cookie{{Name: sessionCookieName, Path: parser.forumURL.Path, MaxAge: -1}})
+
+	resp, err := parser.httpClient.PostForm(parser.forumPageURL(loginUrl), url.Values{
+		"login_username": {login},
+		"login_password": {password},
+		"login":          {submit}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if parser.sessionID() == "" {
+		return parseLoginError(charmap.Windows1251.NewDecoder().Reader(resp.Body))
+	}
+
+	return parser.saveCookies()
+}
+
+// getForumPage загружает страницу форума и возвращает её в UTF-8. Если заданы
+// учётные данные, а сессия истекла, выполняется повторный вход и страница
+// запрашивается снова.
+func (parser *Parser) getForumPage(pageUrl string) ([]byte, error) {
+	err := parser.ensureSession("")
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		session := parser.sessionID()
+
+		b, err := parser.getPage(pageUrl)
+		if err != nil {
+			return nil, err
+		}
+
+		if parser.login == "" || attempt > 0 || parseLoggedIn(b) {
+			return b, nil
+		}
+
+		err = parser.ensureSession(session)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (parser *Parser) getPage(pageUrl string) ([]byte, error) {
+	resp, err := parser.httpClient.Get(pageUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = sources.CheckResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	win1251Bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return charmap.Windows1251.NewDecoder().Bytes(win1251Bytes)
+}
+
+// parseLoggedIn сообщает, открыта ли страница от имени пользователя
+func parseLoggedIn(b []byte) bool {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(b))
+	if err != nil {
+		return false
+	}
+
+	return doc.Find("#logged-in-username").Length() > 0
+}
+
+// parseLoginError определяет причину неудачного входа по странице входа
+func parseLoginError(r io.Reader) error {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return err
+	}
+
+	if doc.Find(`input[name="cap_sid"]`).Length() > 0 {
+		return errCaptchaRequired
+	}
+
+	return errLoginFailed
+}
+
+// loadCookies загружает сохранённые cookie, отсутствие файла не является ошибкой
+func (parser *Parser) loadCookies() error {
+	if parser.cookieFile == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(parser.cookieFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var cookies []*http.Cookie
+	err = json.Unmarshal(b, &cookies)
+	if err != nil {
+		return err
+	}
+
+	// Сохраняются только имена и значения, путь восстанавливается как у cookie форума
+	for _, cookie := range cookies {
+		cookie.Path = parser.forumURL.Path
+	}
+
+	parser.httpClient.Jar.SetCookies(parser.forumURL, cookies)
+
+	return nil
+}
+
+// saveCookies сохраняет cookie форума, файл заменяется целиком
+func (parser *Parser) saveCookies() error {
+	if parser.cookieFile == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(parser.httpClient.Jar.Cookies(parser.forumURL))
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(parser.cookieFile), filepath.Base(parser.cookieFile)+".*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(b)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), parser.cookieFile)
+}
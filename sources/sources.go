@@ -1,8 +1,11 @@
 package sources
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/nxshock/torrentdb/torrent"
 )
@@ -13,7 +16,78 @@ var (
 )
 
 type SourceDriver interface {
-	Open(string) (Source, error)
+	// NewOptions возвращает параметры драйвера со значениями по умолчанию,
+	// в которые декодируется секция конфигурации источника
+	NewOptions() DriverOptions
+
+	Open(DriverOptions) (Source, error)
+}
+
+// Параметры драйвера: *Options или структура, встраивающая Options
+// и дополняющая их параметрами конкретного источника
+type DriverOptions interface {
+	// Common возвращает общие для всех источников параметры
+	Common() *Options
+
+	// Validate проверяет значения параметров
+	Validate() error
+}
+
+// Значение ProxyAddr, отключающее для источника прокси из секции Main
+const ProxyDirect = "direct"
+
+// Общие параметры подключения к источнику
+type Options struct {
+	// Адрес SOCKS5-прокси, пустое значение или ProxyDirect - без прокси
+	ProxyAddr string
+
+	// Адрес сайта источника вида http://host[:port], пустое значение - адрес по умолчанию
+	BaseURL string
+
+	// Зеркала сайта в порядке использования при недоступности основного адреса
+	Mirrors []string
+
+	// Адрес API источника, если оно расположено отдельно от сайта, и его зеркала
+	APIURL     string
+	APIMirrors []string
+
+	// Максимальное кол-во запросов в секунду ко всему источнику, 0 - без ограничения
+	RequestsPerSecond float64
+
+	// Таймаут одной попытки запроса, 0 - без ограничения
+	Timeout time.Duration `toml:"-"`
+
+	// Кол-во повторов запроса при ответах 429/5xx и таймаутах
+	MaxRetries int `toml:"-"`
+
+	// Заголовок User-Agent запросов
+	UserAgent string `toml:"-"`
+
+	// Каталог для файлов, сохраняемых драйвером между запусками
+	DataDir string `toml:"-"`
+
+	// Имя драйвера, заполняется Open
+	name string
+}
+
+func (options *Options) Common() *Options {
+	return options
+}
+
+func (options *Options) Validate() error {
+	if options.RequestsPerSecond < 0 {
+		return errors.New("negative requests per second limit")
+	}
+
+	if len(options.Mirrors) > 0 && options.BaseURL == "" {
+		return errors.New("mirrors are set without base URL")
+	}
+
+	if len(options.APIMirrors) > 0 && options.APIURL == "" {
+		return errors.New("API mirrors are set without API URL")
+	}
+
+	return nil
 }
 
 // Источник торрентов
@@ -29,6 +103,17 @@ type Source interface {
 
 	// Максимальный доступный ID торрента
 	MaxTorrentID() (int, error)
+
+	// Ссылка на страницу темы на источнике
+	TopicURL(int) string
+}
+
+// Источник, поддерживающий получение статистики раздач без загрузки тем целиком
+type StatsSource interface {
+	Source
+
+	// Статистика раздач по списку ID, отсутствующие на источнике ID пропускаются
+	GetStats([]int) (map[int]*torrent.Stats, error)
 }
 
 func Register(name string, sourceDriver SourceDriver) {
@@ -45,7 +130,29 @@ func Register(name string, sourceDriver SourceDriver) {
 	sourcesMap[name] = sourceDriver
 }
 
-func Open(driverName, params string) (Source, error) {
+// NewOptions возвращает параметры драйвера со значениями по умолчанию
+func NewOptions(driverName string) (DriverOptions, error) {
+	driveri, err := driver(driverName)
+	if err != nil {
+		return nil, err
+	}
+
+	return driveri.NewOptions(), nil
+}
+
+// Open открывает источник с параметрами, полученными от NewOptions
+func Open(driverName string, options DriverOptions) (Source, error) {
+	driveri, err := driver(driverName)
+	if err != nil {
+		return nil, err
+	}
+
+	options.Common().name = driverName
+
+	return driveri.Open(options)
+}
+
+func driver(driverName string) (SourceDriver, error) {
 	sourcesMutex.RLock()
 	driveri, ok := sourcesMap[driverName]
 	sourcesMutex.RUnlock()
@@ -53,15 +160,20 @@ func Open(driverName, params string) (Source, error) {
 		return nil, fmt.Errorf(`unknown driver "%q" (forgotten import?)`, driverName)
 	}
 
-	return driveri.Open(params)
+	return driveri, nil
 }
 
+// RegisteredDrivers возвращает имена зарегистрированных драйверов по алфавиту
 func RegisteredDrivers() []string {
+	sourcesMutex.RLock()
+	defer sourcesMutex.RUnlock()
+
 	var registeredDrivers []string
 
 	for driverName := range sourcesMap {
 		registeredDrivers = append(registeredDrivers, driverName)
 	}
+	sort.Strings(registeredDrivers)
 
 	return registeredDrivers
 }
@@ -0,0 +1,51 @@
+package sources
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDriver struct {
+	options DriverOptions
+}
+
+func (driver *testDriver) NewOptions() DriverOptions {
+	return &Options{BaseURL: "http://example.com"}
+}
+
+func (driver *testDriver) Open(options DriverOptions) (Source, error) {
+	driver.options = options
+
+	return nil, nil
+}
+
+func TestOpen(t *testing.T) {
+	driver := new(testDriver)
+	Register("test-b", driver)
+	Register("test-a", driver)
+
+	drivers := RegisteredDrivers()
+	assert.Contains(t, drivers, "test-a")
+	assert.True(t, sort.StringsAreSorted(drivers))
+
+	options, err := NewOptions("test-a")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", options.Common().BaseURL)
+
+	_, err = Open("test-a", options)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-a", driver.options.Common().name)
+
+	_, err = NewOptions("unknown")
+	assert.Error(t, err)
+}
+
+func TestOptionsValidate(t *testing.T) {
+	assert.NoError(t, (&Options{}).Validate())
+	assert.NoError(t, (&Options{BaseURL: "http://example.com", Mirrors: []string{"http://example.org"}}).Validate())
+	assert.Error(t, (&Options{RequestsPerSecond: -1}).Validate())
+	assert.Error(t, (&Options{Mirrors: []string{"http://example.org"}}).Validate())
+	assert.Error(t, (&Options{APIMirrors: []string{"http://api.example.org"}}).Validate())
+}
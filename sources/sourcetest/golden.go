@@ -0,0 +1,53 @@
+package sourcetest
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// С флагом -update эталонные файлы перезаписываются полученными результатами:
+// go test ./sources/rutor -update
+var update = flag.Bool("update", false, "update golden files")
+
+// Golden сравнивает got в виде JSON с эталонным файлом testdata/golden/<name>.json
+func Golden(t *testing.T, name string, got interface{}) {
+	t.Helper()
+
+	b, err := json.MarshalIndent(got, "", "\t")
+	if !assert.NoError(t, err) {
+		return
+	}
+	b = append(b, '\n')
+
+	fileName := filepath.Join("testdata", "golden", name+".json")
+
+	if *update {
+		err = os.MkdirAll(filepath.Dir(fileName), 0755)
+		if assert.NoError(t, err) {
+			assert.NoError(t, ioutil.WriteFile(fileName, b, 0644))
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(fileName)
+	if !assert.NoError(t, err, "run tests with -update flag to create golden file") {
+		return
+	}
+
+	assert.Equal(t, string(expected), string(b), fileName)
+}
+
+// Result возвращает результат разбора для эталонного файла: значение или текст ошибки
+func Result(value interface{}, err error) interface{} {
+	if err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+
+	return value
+}
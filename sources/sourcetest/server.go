@@ -0,0 +1,148 @@
+// Package sourcetest содержит локальный сервер, подменяющий сайты источников
+// в тестах драйверов, и сравнение результатов разбора с эталонными файлами.
+package sourcetest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	"golang.org/x/text/encoding"
+)
+
+// Ответ сервера на запрос
+type Response struct {
+	// Код ответа, 0 - 200
+	StatusCode int
+
+	// Файл с телом ответа
+	File string
+
+	// Кодировка, в которую перекодируется файл, nil - без перекодирования
+	Encoding encoding.Encoding
+
+	// Дополнительные заголовки ответа
+	Header http.Header
+}
+
+// Server - локальный сервер, отдающий заранее записанные страницы.
+// На запросы без заданного ответа сервер отвечает 404, как сайт на несуществующую страницу.
+type Server struct {
+	*httptest.Server
+
+	mutex     sync.Mutex
+	responses map[string]Response
+	handlers  map[string]http.HandlerFunc
+	requests  []string
+}
+
+// NewServer запускает сервер, адрес которого указывается в sources.Options.BaseURL.
+// Сервер необходимо остановить вызовом Close.
+func NewServer() *Server {
+	server := &Server{
+		responses: make(map[string]Response),
+		handlers:  make(map[string]http.HandlerFunc)}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+
+	return server
+}
+
+// Handle задаёт ответ на запрос uri вида /path?a=1&b=2. Параметры POST-запроса
+// сравниваются вместе с параметрами адреса, порядок параметров не важен.
+func (server *Server) Handle(uri string, response Response) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.responses[normalizeURI(uri)] = response
+}
+
+// HandleFunc задаёт обработчик всех запросов к path независимо от параметров
+func (server *Server) HandleFunc(path string, handler http.HandlerFunc) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.handlers[path] = handler
+}
+
+// Requests возвращает выполненные запросы в виде "METHOD uri" в порядке поступления
+func (server *Server) Requests() []string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]string(nil), server.requests...)
+}
+
+func (server *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := requestKey(r.URL.Path, r.Form)
+
+	server.mutex.Lock()
+	server.requests = append(server.requests, r.Method+" "+key)
+	handler := server.handlers[r.URL.Path]
+	response, ok := server.responses[key]
+	server.mutex.Unlock()
+
+	if handler != nil {
+		handler(w, r)
+		return
+	}
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var b []byte
+	if response.File != "" {
+		b, err = ioutil.ReadFile(response.File)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if response.Encoding != nil {
+			b, err = response.Encoding.NewEncoder().Bytes(b)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+
+	statusCode := response.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	w.WriteHeader(statusCode)
+	w.Write(b)
+}
+
+// normalizeURI приводит uri к виду, в котором параметры отсортированы по имени
+func normalizeURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	return requestKey(u.Path, u.Query())
+}
+
+func requestKey(path string, values url.Values) string {
+	if len(values) == 0 {
+		return path
+	}
+
+	return path + "?" + values.Encode()
+}
@@ -0,0 +1,48 @@
+package sourcetest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestServer(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "page.html")
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte("Тема"), 0644))
+
+	server := NewServer()
+	defer server.Close()
+	server.Handle("/page?b=2&a=1", Response{File: fileName, Encoding: charmap.Windows1251})
+	server.Handle("/gone", Response{StatusCode: http.StatusGone})
+
+	resp, err := http.PostForm(server.URL+"/page?a=1", url.Values{"b": {"2"}})
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []byte{0xD2, 0xE5, 0xEC, 0xE0}, b)
+
+	resp, err = http.Get(server.URL + "/gone")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/page?a=1")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	assert.Equal(t, []string{"POST /page?a=1&b=2", "GET /gone", "GET /page?a=1"}, server.Requests())
+}
+
+func TestGoldenResult(t *testing.T) {
+	assert.Equal(t, 1, Result(1, nil))
+	assert.Equal(t, map[string]string{"error": "file does not exist"}, Result(nil, os.ErrNotExist))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nxshock/torrentdb/sources"
+)
+
+// Кол-во торрентов, статистика которых запрашивается и сохраняется за раз
+const statsBatchSize = 100
+
+var errStatsNotSupported = errors.New("source does not support stats")
+
+func updateStatsAll() {
+	drivers := enabledSources()
+	for _, driverName := range drivers {
+		err := updateStats(driverName)
+		if err == errStatsNotSupported {
+			log.Printf("%s: %v", driverName, err)
+		} else if err == errUpdateInterrupted {
+			log.Printf("%s: %v", driverName, err)
+			return
+		} else if err != nil {
+			log.Printf("Update %s stats error: %v", driverName, err)
+		}
+	}
+}
+
+// updateStats обновляет статистику раздач торрентов, опубликованных
+// за последние StatsMaxAge
+func updateStats(driverName string) error {
+	source, err := openSource(driverName)
+	if err != nil {
+		return err
+	}
+
+	statsSource, ok := source.(sources.StatsSource)
+	if !ok {
+		return errStatsNotSupported
+	}
+
+	ids, err := db.GetRecentTopicIDs(source.ID(), time.Now().Add(-config.Main.StatsMaxAge.Duration))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Обновление статистики %s для %d торрентов", driverName, len(ids))
+
+	var updatedCount int
+	for from := 0; from < len(ids); from += statsBatchSize {
+		select {
+		case <-stopUpdate:
+			if showProgress {
+				fmt.Fprintf(os.Stderr, "\n")
+			}
+			return errUpdateInterrupted
+		default:
+		}
+
+		to := from + statsBatchSize
+		if to > len(ids) {
+			to = len(ids)
+		}
+
+		stats, err := statsSource.GetStats(ids[from:to])
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		for id, s := range stats {
+			err = db.UpdateStatsWithTx(tx, source.ID(), id, s)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("save stats %d: %v", id, err)
+			}
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		updatedCount += len(stats)
+
+		if showProgress {
+			fmt.Fprintf(os.Stderr, "\rProcessed %d / %d (updated: %d)...", to, len(ids), updatedCount)
+		}
+	}
+	if showProgress && len(ids) > 0 {
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+
+	log.Printf("Stats update of %s completed (updated: %d, missing: %d).", driverName, updatedCount, len(ids)-updatedCount)
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+// Хранилище данных о торрентах
+type Storage interface {
+	Close() error
+
+	// Begin начинает транзакцию для пакетной вставки
+	Begin() (*sql.Tx, error)
+
+	// SearchTorrentByBtih возвращает основную запись среди тем источников с указанным хешем
+	SearchTorrentByBtih(btih []byte) (*torrent.Torrent, error)
+	// GetListings возвращает все темы источников с указанным хешем
+	GetListings(btih []byte) ([]torrent.Listing, error)
+	// SearchTorrentsByTitle ищет торренты в указанных категориях (во всех, если список пуст),
+	// темы с одинаковым хешем возвращаются одной записью
+	SearchTorrentsByTitle(query string, categories []torrent.Category, sortField SortField, sortDirection SortDirection, limit int, offset int) ([]*torrent.Torrent, error)
+	// CountTorrentsByTitle возвращает кол-во найденных торрентов, но не более maxCount
+	CountTorrentsByTitle(query string, categories []torrent.Category, maxCount int) (int, error)
+	GetLatestTorrents(categories []torrent.Category, limit int, offset int) ([]*torrent.Torrent, error)
+	// InsertTorrent добавляет торрент или обновляет уже загруженный с сохранением истории изменений
+	InsertTorrent(sourceID int, topicID int, torrent *torrent.Torrent) error
+	InsertTorrentWithTx(transaction *sql.Tx, sourceID int, topicID int, torrent *torrent.Torrent) error
+	GetHistory(sourceID int, topicID int) ([]torrent.Revision, error)
+	GetMaxTorrentID(sourceID int) (int, error)
+	GetFiles(sourceID int, topicID int) ([]torrent.File, error)
+
+	// Статистика раздач
+	GetRecentTopicIDs(sourceID int, since time.Time) ([]int, error)
+	UpdateStatsWithTx(transaction *sql.Tx, sourceID int, topicID int, stats *torrent.Stats) error
+
+	// Повторная проверка загруженных торрентов
+	GetRefreshTopicIDs(sourceID int, from, to time.Time, refreshedBefore time.Time, limit int) ([]int, error)
+	SetRefreshTimeWithTx(transaction *sql.Tx, sourceID int, topicID int, refreshTime time.Time) error
+	MarkRemovedWithTx(transaction *sql.Tx, sourceID int, topicID int, removeTime time.Time) error
+
+	// Опрос трекеров
+	GetScrapeTargets(sourceID int, since time.Time) ([]*ScrapeTarget, error)
+	UpdateTrackerStatsWithTx(transaction *sql.Tx, target *ScrapeTarget, stats *torrent.Stats) error
+	UpdateTopicTrackerStatsWithTx(transaction *sql.Tx, sourceID int, topicID int, stats *torrent.Stats) error
+
+	// Контрольные точки обновления
+	GetCheckpoint(sourceID int) (int, error)
+	SetCheckpointWithTx(transaction *sql.Tx, sourceID int, topicID int) error
+
+	// Список ID, которые не удалось получить
+	GetFailedTopics(sourceID int) ([]*FailedTopic, error)
+	RecordFailure(sourceID int, topicID int, err error) error
+	RecordFailureWithTx(transaction *sql.Tx, sourceID int, topicID int, err error) error
+	DeleteFailure(sourceID int, topicID int) error
+	DeleteFailureWithTx(transaction *sql.Tx, sourceID int, topicID int) error
+
+	// Миграции схемы
+	SchemaVersion() (int, error)
+	LatestSchemaVersion() int
+	AppliedMigrations() (map[int]time.Time, error)
+	Migrations() []migration
+	MigrateUp(targetVersion int) error
+	MigrateDown(targetVersion int) error
+}
+
+const (
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+)
+
+var (
+	db Storage
+)
+
+func initDb() error {
+	var err error
+
+	switch config.Database.Driver {
+	case DriverPostgres:
+		db, err = newPostgresDatabase(config.Database)
+	case DriverSqlite:
+		db, err = newSqliteDatabase(config.Database)
+	default:
+		err = fmt.Errorf("unknown database driver: %s", config.Database.Driver)
+	}
+
+	return err
+}
+
+func newDatabase(driver, address string, migrations []migration) (*Database, error) {
+	log.Printf("Connecting to %s database %s...", driver, address)
+
+	db, err := sql.Open(driver, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Database{db: db, migrations: migrations}, nil
+}
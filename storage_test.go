@@ -0,0 +1,270 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+// newTestDb подключает db к новой базе SQLite во временном каталоге
+// с конфигурацией по умолчанию и схемой последней версии
+func newTestDb(t *testing.T) {
+	t.Helper()
+
+	config = new(Config)
+	config.Database.Driver = DriverSqlite
+	config.Database.Path = filepath.Join(t.TempDir(), "torrentdb.db")
+	config.ApplyDefaults()
+	err := config.decodeSources(toml.MetaData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = initDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = db.MigrateUp(db.LatestSchemaVersion())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// insertTestTorrent добавляет торрент с одним файлом
+func insertTestTorrent(t *testing.T, sourceID, topicID int, title string, btih byte, category torrent.Category) {
+	t.Helper()
+
+	err := db.InsertTorrent(sourceID, topicID, &torrent.Torrent{
+		Title:           title,
+		Btih:            []byte{btih},
+		PublicationTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(topicID) * time.Hour),
+		Size:            uint64(topicID),
+		Category:        category,
+		Files:           []torrent.File{{Path: "Folder/" + title + ".mkv", Size: uint64(topicID)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchTorrentsByTitle(t *testing.T) {
+	newTestDb(t)
+
+	insertTestTorrent(t, 1, 10, "Movie one", 1, torrent.CategoryMovies)
+	insertTestTorrent(t, 2, 20, "Movie two", 2, torrent.CategoryTV)
+	insertTestTorrent(t, 2, 30, "Фильм", 1, torrent.CategoryMovies) // та же раздача на другом источнике
+	insertTestTorrent(t, 1, 40, "Music", 3, torrent.CategoryMusic)
+
+	tests := []struct {
+		query      string
+		categories []torrent.Category
+		expected   []int // ID тем в порядке убывания времени публикации
+	}{
+		{"movie", nil, []int{20, 10}},
+		{"фильм", nil, []int{10}}, // найдена по названию темы, возвращается основная запись
+		{"folder", nil, []int{40, 20, 10}},
+		{"movie one", nil, []int{10}},
+		{"movie", []torrent.Category{torrent.CategoryTV}, []int{20}},
+		{"missing", nil, nil},
+		{`"`, nil, nil},
+		{"", nil, nil},
+	}
+
+	for _, test := range tests {
+		torrents, err := db.SearchTorrentsByTitle(test.query, test.categories, FieldTime, SortDirectionDesc, 10, 0)
+		assert.NoError(t, err, test.query)
+
+		var ids []int
+		for _, result := range torrents {
+			ids = append(ids, result.TopicID)
+		}
+		assert.Equal(t, test.expected, ids, test.query)
+
+		count, err := db.CountTorrentsByTitle(test.query, test.categories, 10)
+		assert.NoError(t, err, test.query)
+		assert.Equal(t, len(test.expected), count, test.query)
+	}
+
+	count, err := db.CountTorrentsByTitle("folder", nil, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestFtsQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"", ""},
+		{"  ", ""},
+		{"movie", `"movie"`},
+		{" movie  2020 ", `"movie" "2020"`},
+		{`a"b OR -c*`, `"a""b" "OR" "-c*"`},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, ftsQuery(test.query), test.query)
+	}
+}
+
+func TestSourceAndTrackerStats(t *testing.T) {
+	newTestDb(t)
+
+	insertTestTorrent(t, testSourceID, 1, "Movie one", 1, torrent.CategoryMovies)
+	insertTestTorrent(t, testSourceID, 2, "Movie two", 2, torrent.CategoryMovies)
+
+	sourceTime := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	trackerTime := sourceTime.Add(time.Hour)
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	assert.NoError(t, db.UpdateStatsWithTx(tx, testSourceID, 1, &torrent.Stats{Seeders: 5, Leechers: 4, UpdateTime: sourceTime}))
+	assert.NoError(t, tx.Commit())
+
+	assert.NoError(t, saveTrackerStats(testSourceID, map[int]*torrent.Stats{
+		1: {Seeders: 8, Leechers: 1, Completed: 20, UpdateTime: trackerTime},
+		2: {Seeders: 3, UpdateTime: trackerTime}}))
+
+	// Обновление статистики источника не затирает статистику трекеров
+	tx, err = db.Begin()
+	assert.NoError(t, err)
+	assert.NoError(t, db.UpdateStatsWithTx(tx, testSourceID, 1, &torrent.Stats{Seeders: 6, Leechers: 4, UpdateTime: sourceTime}))
+	assert.NoError(t, tx.Commit())
+
+	result, err := db.SearchTorrentByBtih([]byte{1})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, result.Seeders)
+	assert.Equal(t, 4, result.Leechers)
+	assert.Equal(t, 20, result.Completed)
+	assert.True(t, result.Stats.UpdateTime.Equal(trackerTime), "%v", result.Stats.UpdateTime)
+
+	result, err = db.SearchTorrentByBtih([]byte{2})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Seeders)
+
+	torrents, err := db.SearchTorrentsByTitle("movie", nil, FieldSeeders, "", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, torrents, 2) {
+		assert.Equal(t, 1, torrents[0].TopicID)
+		assert.Equal(t, 2, torrents[1].TopicID)
+	}
+}
+
+func TestInsertTorrentUpdate(t *testing.T) {
+	newTestDb(t)
+
+	statsTime := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	publicationTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, db.InsertTorrent(testSourceID, 1, &torrent.Torrent{
+		Title:           "Movie",
+		Btih:            []byte{1},
+		PublicationTime: publicationTime,
+		Size:            100,
+		Category:        torrent.CategoryMovies,
+		Stats:           torrent.Stats{Seeders: 5, Leechers: 2, UpdateTime: statsTime},
+		Files:           []torrent.File{{Path: "Movie.avi", Size: 100}},
+		Trackers:        []string{"http://tracker/announce"}}))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, db.MarkRemovedWithTx(tx, testSourceID, 1, statsTime))
+	assert.NoError(t, tx.Commit())
+
+	tests := []struct {
+		title       string
+		btih        byte
+		size        uint64
+		revisions   int // кол-во записей в истории после обновления
+		description string
+	}{
+		{"Movie", 1, 100, 0, "unchanged"},
+		{"Movie (2020)", 1, 100, 1, "title changed"},
+		{"Movie (2020)", 2, 200, 2, "btih and size changed"},
+		{"Movie (2020)", 2, 200, 2, "unchanged again"},
+	}
+
+	for _, test := range tests {
+		// Источник не вернул статистику, сохранённая не затирается
+		assert.NoError(t, db.InsertTorrent(testSourceID, 1, &torrent.Torrent{
+			Title:           test.title,
+			Btih:            []byte{test.btih},
+			PublicationTime: publicationTime,
+			Size:            test.size,
+			Category:        torrent.CategoryMovies,
+			Files:           []torrent.File{{Path: test.title + ".mkv", Size: test.size}}}), test.description)
+
+		result, err := db.SearchTorrentByBtih([]byte{test.btih})
+		if !assert.NoError(t, err, test.description) {
+			continue
+		}
+		assert.Equal(t, test.title, result.Title, test.description)
+		assert.Equal(t, test.size, result.Size, test.description)
+		assert.Equal(t, 5, result.Seeders, test.description)
+		assert.Equal(t, 2, result.Leechers, test.description)
+		assert.True(t, result.Stats.UpdateTime.Equal(statsTime), test.description)
+		assert.True(t, result.RemoveTime.IsZero(), test.description)
+		assert.Equal(t, test.revisions > 0, result.IsChanged(), test.description)
+
+		history, err := db.GetHistory(testSourceID, 1)
+		assert.NoError(t, err, test.description)
+		assert.Len(t, history, test.revisions, test.description)
+
+		files, err := db.GetFiles(testSourceID, 1)
+		assert.NoError(t, err, test.description)
+		assert.Equal(t, []torrent.File{{Path: test.title + ".mkv", Size: test.size}}, files, test.description)
+	}
+
+	// В истории сохраняются предыдущие версии, новые первыми
+	history, err := db.GetHistory(testSourceID, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "Movie (2020)", history[0].Title)
+		assert.Equal(t, []byte{1}, history[0].Btih)
+		assert.Equal(t, uint64(100), history[0].Size)
+		assert.Equal(t, "Movie", history[1].Title)
+	}
+
+	targets, err := db.GetScrapeTargets(testSourceID, publicationTime)
+	assert.NoError(t, err)
+	assert.Empty(t, targets)
+}
+
+func TestSearchAfterUpdate(t *testing.T) {
+	newTestDb(t)
+
+	insertTestTorrent(t, testSourceID, 1, "Movie one", 1, torrent.CategoryMovies)
+
+	// Обновление статистики не затрагивает полнотекстовый индекс
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, db.UpdateStatsWithTx(tx, testSourceID, 1, &torrent.Stats{Seeders: 1, UpdateTime: time.Now()}))
+	assert.NoError(t, tx.Commit())
+
+	insertTestTorrent(t, testSourceID, 1, "Film one", 1, torrent.CategoryMovies)
+
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{"film", 1},
+		{"movie", 0},
+		{"one", 1},
+	}
+
+	for _, test := range tests {
+		count, err := db.CountTorrentsByTitle(test.query, nil, 10)
+		assert.NoError(t, err, test.query)
+		assert.Equal(t, test.expected, count, test.query)
+	}
+}
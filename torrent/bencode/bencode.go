@@ -0,0 +1,376 @@
+// Package bencode реализует кодирование, используемое в .torrent-файлах (BEP 3).
+//
+// Значения представляются следующими типами Go:
+// целые числа - int64, строки - string, списки - []interface{},
+// словари - map[string]interface{}.
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Максимальная вложенность списков и словарей
+const maxDepth = 256
+
+var (
+	ErrUnexpectedEnd = errors.New("bencode: unexpected end of data")
+	ErrTrailingData  = errors.New("bencode: trailing data after value")
+	ErrTooDeep       = errors.New("bencode: nesting is too deep")
+)
+
+// SyntaxError описывает ошибку в закодированных данных
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("bencode: %s at offset %d", e.Msg, e.Offset)
+}
+
+type decoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// Decode декодирует одно значение, занимающее все данные
+func Decode(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+
+	if d.pos != len(d.data) {
+		return nil, ErrTrailingData
+	}
+
+	return v, nil
+}
+
+// RawValue возвращает закодированное значение ключа key словаря верхнего
+// уровня без перекодирования. Используется для вычисления хеша info.
+// Словарь проверяется целиком, как при Decode.
+func RawValue(data []byte, key string) ([]byte, error) {
+	d := &decoder{data: data}
+
+	if d.pos >= len(d.data) {
+		return nil, ErrUnexpectedEnd
+	}
+	if d.data[d.pos] != 'd' {
+		return nil, &SyntaxError{d.pos, "expected dictionary"}
+	}
+	d.pos++
+
+	var (
+		raw  []byte
+		seen = make(map[string]bool)
+	)
+	for {
+		if d.pos >= len(d.data) {
+			return nil, ErrUnexpectedEnd
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			break
+		}
+
+		k, err := d.key(seen)
+		if err != nil {
+			return nil, err
+		}
+
+		start := d.pos
+		err = d.skip()
+		if err != nil {
+			return nil, err
+		}
+
+		if k == key {
+			raw = d.data[start:d.pos]
+		}
+	}
+
+	if d.pos != len(d.data) {
+		return nil, ErrTrailingData
+	}
+
+	if raw == nil {
+		return nil, fmt.Errorf("bencode: key %q not found", key)
+	}
+
+	return raw, nil
+}
+
+func (d *decoder) value() (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, ErrUnexpectedEnd
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		return d.int()
+	case c >= '0' && c <= '9':
+		return d.string()
+	case c == 'l':
+		return d.list()
+	case c == 'd':
+		return d.dict()
+	default:
+		return nil, &SyntaxError{d.pos, fmt.Sprintf("unexpected character %q", c)}
+	}
+}
+
+// skip пропускает значение без сохранения
+func (d *decoder) skip() error {
+	_, err := d.value()
+
+	return err
+}
+
+func (d *decoder) int() (int64, error) {
+	d.pos++ // 'i'
+
+	end := bytes.IndexByte(d.data[d.pos:], 'e')
+	if end < 0 {
+		return 0, ErrUnexpectedEnd
+	}
+
+	s := string(d.data[d.pos : d.pos+end])
+	if !isInteger(s) {
+		return 0, &SyntaxError{d.pos, fmt.Sprintf("invalid integer %q", s)}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, &SyntaxError{d.pos, fmt.Sprintf("invalid integer %q", s)}
+	}
+
+	d.pos += end + 1
+
+	return n, nil
+}
+
+// isInteger проверяет запись целого числа: необязательный минус и цифры
+// без ведущих нулей, "-0" не допускается
+func isInteger(s string) bool {
+	digits := s
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+
+	if digits == "" || (len(digits) > 1 && digits[0] == '0') || s == "-0" {
+		return false
+	}
+
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d *decoder) string() (string, error) {
+	if d.pos >= len(d.data) {
+		return "", ErrUnexpectedEnd
+	}
+	if c := d.data[d.pos]; c < '0' || c > '9' {
+		return "", &SyntaxError{d.pos, "expected string"}
+	}
+
+	colon := bytes.IndexByte(d.data[d.pos:], ':')
+	if colon < 0 {
+		return "", ErrUnexpectedEnd
+	}
+
+	lengthStr := string(d.data[d.pos : d.pos+colon])
+	if len(lengthStr) > 1 && lengthStr[0] == '0' {
+		return "", &SyntaxError{d.pos, fmt.Sprintf("invalid string length %q", lengthStr)}
+	}
+
+	length, err := strconv.Atoi(lengthStr)
+	if err != nil || length < 0 {
+		return "", &SyntaxError{d.pos, fmt.Sprintf("invalid string length %q", lengthStr)}
+	}
+
+	d.pos += colon + 1
+	if length > len(d.data)-d.pos {
+		return "", ErrUnexpectedEnd
+	}
+
+	s := string(d.data[d.pos : d.pos+length])
+	d.pos += length
+
+	return s, nil
+}
+
+// key читает ключ словаря и запоминает его в seen. Повторяющийся ключ - ошибка,
+// иначе разные декодеры выбрали бы разные значения. Порядок ключей по BEP 3
+// должен быть возрастающим, но встречаются файлы с неупорядоченными ключами,
+// поэтому он не проверяется.
+func (d *decoder) key(seen map[string]bool) (string, error) {
+	offset := d.pos
+
+	k, err := d.string()
+	if err != nil {
+		return "", err
+	}
+
+	if seen[k] {
+		return "", &SyntaxError{offset, fmt.Sprintf("duplicate key %q", k)}
+	}
+	seen[k] = true
+
+	return k, nil
+}
+
+func (d *decoder) list() ([]interface{}, error) {
+	d.depth++
+	if d.depth > maxDepth {
+		return nil, ErrTooDeep
+	}
+	defer func() { d.depth-- }()
+
+	d.pos++ // 'l'
+
+	list := []interface{}{}
+	for {
+		if d.pos >= len(d.data) {
+			return nil, ErrUnexpectedEnd
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			return list, nil
+		}
+
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, v)
+	}
+}
+
+func (d *decoder) dict() (map[string]interface{}, error) {
+	d.depth++
+	if d.depth > maxDepth {
+		return nil, ErrTooDeep
+	}
+	defer func() { d.depth-- }()
+
+	d.pos++ // 'd'
+
+	dict := make(map[string]interface{})
+	seen := make(map[string]bool)
+	for {
+		if d.pos >= len(d.data) {
+			return nil, ErrUnexpectedEnd
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			return dict, nil
+		}
+
+		k, err := d.key(seen)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+
+		dict[k] = v
+	}
+}
+
+// Encode кодирует значение. Поддерживаются целые числа, string, []byte,
+// []string, []interface{}, map[string]interface{}.
+func Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := encode(&buf, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case int:
+		encodeInt(buf, int64(v))
+	case int32:
+		encodeInt(buf, int64(v))
+	case int64:
+		encodeInt(buf, v)
+	case uint32:
+		encodeInt(buf, int64(v))
+	case uint64:
+		buf.WriteByte('i')
+		buf.WriteString(strconv.FormatUint(v, 10))
+		buf.WriteByte('e')
+	case string:
+		encodeString(buf, v)
+	case []byte:
+		encodeString(buf, string(v))
+	case []string:
+		buf.WriteByte('l')
+		for _, s := range v {
+			encodeString(buf, s)
+		}
+		buf.WriteByte('e')
+	case []interface{}:
+		buf.WriteByte('l')
+		for _, item := range v {
+			err := encode(buf, item)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('d')
+		for _, k := range keys {
+			encodeString(buf, k)
+			err := encode(buf, v[k])
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	default:
+		return fmt.Errorf("bencode: unsupported type %T", v)
+	}
+
+	return nil
+}
+
+func encodeInt(buf *bytes.Buffer, n int64) {
+	buf.WriteByte('i')
+	buf.WriteString(strconv.FormatInt(n, 10))
+	buf.WriteByte('e')
+}
+
+func encodeString(buf *bytes.Buffer, s string) {
+	buf.WriteString(strconv.Itoa(len(s)))
+	buf.WriteByte(':')
+	buf.WriteString(s)
+}
@@ -0,0 +1,141 @@
+package bencode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected interface{}
+	}{
+		{"i42e", int64(42)},
+		{"i-42e", int64(-42)},
+		{"i0e", int64(0)},
+		{"4:spam", "spam"},
+		{"0:", ""},
+		{"le", []interface{}{}},
+		{"l4:spami42ee", []interface{}{"spam", int64(42)}},
+		{"d3:bar4:spam3:fooi42ee", map[string]interface{}{"bar": "spam", "foo": int64(42)}},
+		{"d4:listl1:a1:bee", map[string]interface{}{"list": []interface{}{"a", "b"}}},
+		{"d3:fooi1e3:bari2ee", map[string]interface{}{"foo": int64(1), "bar": int64(2)}}, // ключи не упорядочены
+		{"d1:ad1:bi1e1:ai2eee", map[string]interface{}{"a": map[string]interface{}{"b": int64(1), "a": int64(2)}}},
+	}
+
+	for _, test := range tests {
+		got, err := Decode([]byte(test.s))
+		assert.NoError(t, err, test.s)
+		assert.Equal(t, test.expected, got, test.s)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"i42",
+		"ie",
+		"i-e",
+		"i-0e",
+		"i03e",
+		"iabce",
+		"i+42e",
+		"i-+42e",
+		"i 42e",
+		"5:spam",
+		"04:spam",
+		"l4:spam",
+		"d3:fooe",
+		"di1ei2ee",
+		"d3:fooi1e3:fooi2ee",
+		"d1:ai1e1:bi2e1:ai3ee",
+		"d1:ad1:bi1e1:bi2eee",
+		"x",
+		"i1ei2e",
+	}
+
+	for _, s := range tests {
+		_, err := Decode([]byte(s))
+		assert.Error(t, err, s)
+	}
+}
+
+func TestDecodeTooDeep(t *testing.T) {
+	s := make([]byte, 0, 2*(maxDepth+1))
+	for i := 0; i <= maxDepth; i++ {
+		s = append(s, 'l')
+	}
+	for i := 0; i <= maxDepth; i++ {
+		s = append(s, 'e')
+	}
+
+	_, err := Decode(s)
+	assert.Equal(t, ErrTooDeep, err)
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	v := map[string]interface{}{
+		"int":    int64(-7),
+		"string": "строка",
+		"binary": string([]byte{0, 1, 2, 255}),
+		"list":   []interface{}{int64(1), "two", []interface{}{}},
+		"dict":   map[string]interface{}{"b": int64(2), "a": int64(1)},
+	}
+
+	b, err := Encode(v)
+	assert.NoError(t, err)
+
+	got, err := Decode(b)
+	assert.NoError(t, err)
+	assert.Equal(t, v, got)
+}
+
+func TestEncodeSortsKeys(t *testing.T) {
+	b, err := Encode(map[string]interface{}{"b": 1, "a": []string{"x"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "d1:al1:xe1:bi1ee", string(b))
+}
+
+func TestEncodeUnsupportedType(t *testing.T) {
+	_, err := Encode(1.5)
+	assert.Error(t, err)
+}
+
+func TestRawValue(t *testing.T) {
+	data := []byte("d8:announce3:url4:infod6:lengthi5e4:name4:teste5:zzzzzi1ee")
+
+	raw, err := RawValue(data, "info")
+	assert.NoError(t, err)
+	assert.Equal(t, "d6:lengthi5e4:name4:teste", string(raw))
+
+	_, err = RawValue(data, "missing")
+	assert.Error(t, err)
+}
+
+func TestRawValueKeys(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected string // пустая строка - ошибка
+	}{
+		// Неупорядоченные ключи допускаются, значение возвращается без изменений
+		{"d4:infod1:ai1ee1:ai1ee", "d1:ai1ee"},
+		{"d4:infod1:bi1e1:ai2eee", "d1:bi1e1:ai2ee"},
+
+		// С повторяющимся ключом info хеш не совпал бы с результатом Decode
+		{"d4:infod1:ai1ee4:infod1:bi2eee", ""},
+		{"d4:infod1:ai1ee1:bi1e4:infod1:bi2eee", ""},
+		{"d4:infod1:ai1e1:ai2eee", ""},
+	}
+
+	for _, test := range tests {
+		raw, err := RawValue([]byte(test.s), "info")
+		if test.expected == "" {
+			assert.Error(t, err, test.s)
+			continue
+		}
+
+		assert.NoError(t, err, test.s)
+		assert.Equal(t, test.expected, string(raw), test.s)
+	}
+}
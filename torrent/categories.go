@@ -0,0 +1,67 @@
+package torrent
+
+import (
+	"fmt"
+)
+
+// Category - общая для всех источников категория торрента.
+// Значения хранятся в БД, поэтому изменять их нельзя, только добавлять новые.
+type Category int
+
+const (
+	CategoryOther      Category = 0
+	CategoryMovies     Category = 1
+	CategoryTV         Category = 2
+	CategoryMusic      Category = 3
+	CategoryAudiobooks Category = 4
+	CategoryBooks      Category = 5
+	CategorySoftware   Category = 6
+	CategoryGames      Category = 7
+)
+
+type categoryInfo struct {
+	name  string // Идентификатор для URL и API
+	title string // Название для отображения
+}
+
+var categoryInfos = map[Category]categoryInfo{
+	CategoryMovies:     {"movies", "Фильмы"},
+	CategoryTV:         {"tv", "Сериалы и ТВ"},
+	CategoryMusic:      {"music", "Музыка"},
+	CategoryAudiobooks: {"audiobooks", "Аудиокниги"},
+	CategoryBooks:      {"books", "Книги"},
+	CategorySoftware:   {"software", "Программы"},
+	CategoryGames:      {"games", "Игры"},
+	CategoryOther:      {"other", "Другое"}}
+
+// Categories возвращает список всех категорий
+func Categories() []Category {
+	return []Category{CategoryMovies, CategoryTV, CategoryMusic, CategoryAudiobooks, CategoryBooks, CategorySoftware, CategoryGames, CategoryOther}
+}
+
+// ParseCategory возвращает категорию по её идентификатору
+func ParseCategory(name string) (Category, error) {
+	for category, info := range categoryInfos {
+		if info.name == name {
+			return category, nil
+		}
+	}
+
+	return CategoryOther, fmt.Errorf("unknown category: %s", name)
+}
+
+func (category Category) String() string {
+	if info, ok := categoryInfos[category]; ok {
+		return info.name
+	}
+
+	return categoryInfos[CategoryOther].name
+}
+
+func (category Category) Title() string {
+	if info, ok := categoryInfos[category]; ok {
+		return info.title
+	}
+
+	return categoryInfos[CategoryOther].title
+}
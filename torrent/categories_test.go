@@ -0,0 +1,20 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCategory(t *testing.T) {
+	for _, category := range Categories() {
+		parsed, err := ParseCategory(category.String())
+		assert.NoError(t, err)
+		assert.Equal(t, category, parsed)
+	}
+
+	_, err := ParseCategory("unknown")
+	assert.Error(t, err)
+
+	assert.Equal(t, "other", Category(100).String())
+}
@@ -0,0 +1,78 @@
+package torrent
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// Узел дерева файлов торрента
+type FileTreeNode struct {
+	Name     string
+	Size     uint64
+	Children []*FileTreeNode
+
+	childrenByName map[string]*FileTreeNode
+}
+
+func (node *FileTreeNode) IsDir() bool {
+	return node.childrenByName != nil
+}
+
+func (node *FileTreeNode) HumanSize() template.HTML {
+	return humanSize(node.Size)
+}
+
+// BuildFileTree строит дерево каталогов из списка файлов.
+// Размер каталога равен сумме размеров вложенных файлов.
+func BuildFileTree(files []File) []*FileTreeNode {
+	root := &FileTreeNode{childrenByName: make(map[string]*FileTreeNode)}
+
+	for _, file := range files {
+		node := root
+		node.Size += file.Size
+
+		parts := strings.Split(file.Path, "/")
+		for i, part := range parts {
+			child, exists := node.childrenByName[part]
+			if !exists {
+				child = &FileTreeNode{Name: part}
+				if i < len(parts)-1 {
+					child.childrenByName = make(map[string]*FileTreeNode)
+				}
+				node.childrenByName[part] = child
+				node.Children = append(node.Children, child)
+			}
+
+			child.Size += file.Size
+			node = child
+			if node.childrenByName == nil {
+				break
+			}
+		}
+	}
+
+	sortFileTree(root.Children)
+
+	return root.Children
+}
+
+// sortFileTree сортирует узлы: сначала каталоги, затем файлы, по имени
+func sortFileTree(nodes []*FileTreeNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].IsDir() != nodes[j].IsDir() {
+			return nodes[i].IsDir()
+		}
+
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	for _, node := range nodes {
+		sortFileTree(node.Children)
+	}
+}
+
+// FileTree возвращает дерево файлов торрента
+func (t *Torrent) FileTree() []*FileTreeNode {
+	return BuildFileTree(t.Files)
+}
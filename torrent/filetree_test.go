@@ -0,0 +1,40 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildFileTree(t *testing.T) {
+	files := []File{
+		{"Release/video.mkv", 100},
+		{"Release/Subs/rus.srt", 20},
+		{"Release/Subs/eng.srt", 10},
+		{"Release/readme.txt", 1}}
+
+	tree := BuildFileTree(files)
+	assert.Len(t, tree, 1)
+
+	release := tree[0]
+	assert.Equal(t, "Release", release.Name)
+	assert.True(t, release.IsDir())
+	assert.Equal(t, uint64(131), release.Size)
+
+	assert.Len(t, release.Children, 3)
+	assert.Equal(t, "Subs", release.Children[0].Name)
+	assert.Equal(t, uint64(30), release.Children[0].Size)
+	assert.Equal(t, "eng.srt", release.Children[0].Children[0].Name)
+	assert.Equal(t, "readme.txt", release.Children[1].Name)
+	assert.False(t, release.Children[1].IsDir())
+	assert.Equal(t, "video.mkv", release.Children[2].Name)
+}
+
+func TestBuildFileTreeSingleFile(t *testing.T) {
+	tree := BuildFileTree([]File{{"file.iso", 5}})
+
+	assert.Len(t, tree, 1)
+	assert.Equal(t, "file.iso", tree[0].Name)
+	assert.False(t, tree[0].IsDir())
+	assert.Equal(t, uint64(5), tree[0].Size)
+}
@@ -1,23 +1,58 @@
 package torrent
 
 import (
+	"encoding/base32"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
 type UrnType string
 
 const (
+	// Хеш BitTorrent v1 (SHA-1)
 	BitTorrent = UrnType("btih")
+
+	// Multihash BitTorrent v2 (SHA-256)
+	BitTorrentV2 = UrnType("btmh")
+)
+
+const (
+	btihSize = 20
+
+	// Код SHA-256 в multihash и длина хеша
+	multihashSha256     = 0x12
+	multihashSha256Size = 32
 )
 
+// Magnet-ссылка (BEP 9)
 type MagnetLink struct {
-	UrnType        UrnType
-	UrnHash        []byte
-	TrackerAddress string
+	// Хеш BitTorrent v1 (xt=urn:btih)
+	InfoHash []byte
+
+	// Multihash BitTorrent v2 (xt=urn:btmh) вместе с кодом и длиной
+	InfoHashV2 []byte
+
+	// Отображаемое имя (dn)
+	DisplayName string
+
+	// Размер в байтах (xl)
+	ExactLength uint64
+
+	// Адреса трекеров (tr)
+	Trackers []string
+
+	// Адреса веб-сидов (ws)
+	WebSeeds []string
+
+	// Адреса .torrent-файла (as)
+	AcceptableSources []string
+
+	// Адреса пиров (x.pe)
+	Peers []string
 }
 
 func ParseMagnet(s string) (MagnetLink, error) {
@@ -26,23 +61,84 @@ func ParseMagnet(s string) (MagnetLink, error) {
 		return MagnetLink{}, err
 	}
 
-	values := u.Query()
+	if u.Scheme != "magnet" {
+		return MagnetLink{}, fmt.Errorf("unexpected scheme: %q", u.Scheme)
+	}
 
-	urnType, urnHash, err := parseUrn(values.Get("xt"))
+	values, err := url.ParseQuery(u.RawQuery)
 	if err != nil {
 		return MagnetLink{}, err
 	}
 
-	magnetLink := MagnetLink{
-		UrnType:        urnType,
-		UrnHash:        urnHash,
-		TrackerAddress: values.Get("tr")}
+	var magnetLink MagnetLink
+
+	for _, xt := range values["xt"] {
+		urnType, urnHash, err := parseUrn(xt)
+		if err != nil {
+			return MagnetLink{}, err
+		}
+
+		switch urnType {
+		case BitTorrent:
+			magnetLink.InfoHash = urnHash
+		case BitTorrentV2:
+			magnetLink.InfoHashV2 = urnHash
+		}
+	}
+
+	if magnetLink.InfoHash == nil && magnetLink.InfoHashV2 == nil {
+		return MagnetLink{}, errors.New("no btih or btmh urn found")
+	}
+
+	magnetLink.DisplayName = values.Get("dn")
+
+	if xl := values.Get("xl"); xl != "" {
+		magnetLink.ExactLength, err = strconv.ParseUint(xl, 10, 64)
+		if err != nil {
+			return MagnetLink{}, fmt.Errorf("wrong exact length: %v", err)
+		}
+	}
+
+	magnetLink.Trackers = values["tr"]
+	magnetLink.WebSeeds = values["ws"]
+	magnetLink.AcceptableSources = values["as"]
+	magnetLink.Peers = values["x.pe"]
 
 	return magnetLink, nil
 }
 
+// String возвращает magnet-ссылку. Результат разбирается ParseMagnet
+// в исходную структуру.
 func (m *MagnetLink) String() string {
-	return fmt.Sprintf("magnet:?xt=urn:%s:%x&tr=%s", m.UrnType, m.UrnHash, m.TrackerAddress)
+	var params []string
+
+	if m.InfoHash != nil {
+		params = append(params, "xt=urn:"+string(BitTorrent)+":"+hex.EncodeToString(m.InfoHash))
+	}
+	if m.InfoHashV2 != nil {
+		params = append(params, "xt=urn:"+string(BitTorrentV2)+":"+hex.EncodeToString(m.InfoHashV2))
+	}
+	if m.DisplayName != "" {
+		params = append(params, "dn="+url.QueryEscape(m.DisplayName))
+	}
+	if m.ExactLength > 0 {
+		params = append(params, "xl="+strconv.FormatUint(m.ExactLength, 10))
+	}
+
+	for _, v := range []struct {
+		key    string
+		values []string
+	}{
+		{"tr", m.Trackers},
+		{"ws", m.WebSeeds},
+		{"as", m.AcceptableSources},
+		{"x.pe", m.Peers}} {
+		for _, value := range v.values {
+			params = append(params, v.key+"="+url.QueryEscape(value))
+		}
+	}
+
+	return "magnet:?" + strings.Join(params, "&")
 }
 
 func parseUrn(s string) (urnType UrnType, urnHash []byte, err error) {
@@ -54,7 +150,7 @@ func parseUrn(s string) (urnType UrnType, urnHash []byte, err error) {
 
 	var p int
 	if p = strings.Index(s, ":"); p == -1 {
-		return "", nil, errors.New("?")
+		return "", nil, errors.New("no urn type")
 	}
 
 	urnType = UrnType(s[:p])
@@ -63,7 +159,9 @@ func parseUrn(s string) (urnType UrnType, urnHash []byte, err error) {
 
 	switch urnType {
 	case BitTorrent:
-		urnHash, err = hex.DecodeString(s)
+		urnHash, err = parseBtih(s)
+	case BitTorrentV2:
+		urnHash, err = parseBtmh(s)
 	}
 	if err != nil {
 		return "", nil, err
@@ -72,11 +170,39 @@ func parseUrn(s string) (urnType UrnType, urnHash []byte, err error) {
 	return urnType, urnHash, nil
 }
 
-func (m *MagnetLink) HashStr() (string, error) {
-	switch m.UrnType {
-	case BitTorrent:
-		return hex.EncodeToString(m.UrnHash), nil
+// parseBtih разбирает хеш v1 в шестнадцатеричном (40 символов)
+// или base32 (32 символа) представлении
+func parseBtih(s string) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	switch len(s) {
+	case hex.EncodedLen(btihSize):
+		b, err = hex.DecodeString(s)
+	case base32.StdEncoding.EncodedLen(btihSize):
+		b, err = base32.StdEncoding.DecodeString(strings.ToUpper(s))
+	default:
+		return nil, fmt.Errorf("wrong btih length: %d", len(s))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wrong btih: %v", err)
+	}
+
+	return b, nil
+}
+
+// parseBtmh разбирает multihash v2 в шестнадцатеричном представлении
+func parseBtmh(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("wrong btmh: %v", err)
+	}
+
+	if len(b) != 2+multihashSha256Size || b[0] != multihashSha256 || b[1] != multihashSha256Size {
+		return nil, errors.New("wrong btmh: expected sha2-256 multihash")
 	}
 
-	return "", fmt.Errorf("unknown type: %v", m.UrnType)
+	return b, nil
 }
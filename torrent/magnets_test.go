@@ -0,0 +1,105 @@
+package torrent
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMagnet(t *testing.T) {
+	s := "magnet:?xt=urn:btih:55fcd06474e50f49003f7e93681763afaa4d506d" +
+		"&dn=Some+Release+%5B2020%5D" +
+		"&xl=524722552" +
+		"&tr=http%3A%2F%2Fbt.t-ru.org%2Fann%3Fmagnet" +
+		"&tr=udp%3A%2F%2Fopentor.org%3A2710" +
+		"&ws=https%3A%2F%2Fexample.com%2Ffile" +
+		"&as=https%3A%2F%2Fexample.com%2Ffile.torrent"
+
+	m, err := ParseMagnet(s)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "55fcd06474e50f49003f7e93681763afaa4d506d", hex.EncodeToString(m.InfoHash))
+	assert.Nil(t, m.InfoHashV2)
+	assert.Equal(t, "Some Release [2020]", m.DisplayName)
+	assert.Equal(t, uint64(524722552), m.ExactLength)
+	assert.Equal(t, []string{"http://bt.t-ru.org/ann?magnet", "udp://opentor.org:2710"}, m.Trackers)
+	assert.Equal(t, []string{"https://example.com/file"}, m.WebSeeds)
+	assert.Equal(t, []string{"https://example.com/file.torrent"}, m.AcceptableSources)
+}
+
+func TestParseMagnetBase32(t *testing.T) {
+	hexMagnet, err := ParseMagnet("magnet:?xt=urn:btih:55fcd06474e50f49003f7e93681763afaa4d506d")
+	assert.NoError(t, err)
+
+	for _, s := range []string{
+		"magnet:?xt=urn:btih:KX6NAZDU4UHUSAB7P2JWQF3DV6VE2UDN",
+		"magnet:?xt=urn:btih:kx6nazdu4uhusab7p2jwqf3dv6ve2udn"} {
+		m, err := ParseMagnet(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, hexMagnet.InfoHash, m.InfoHash, s)
+	}
+}
+
+func TestParseMagnetV2(t *testing.T) {
+	const btmh = "1220caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e"
+
+	m, err := ParseMagnet("magnet:?xt=urn:btmh:" + btmh + "&dn=bittorrent-v2-test")
+	assert.NoError(t, err)
+	assert.Nil(t, m.InfoHash)
+	assert.Equal(t, btmh, hex.EncodeToString(m.InfoHashV2))
+
+	// Гибридная ссылка
+	m, err = ParseMagnet("magnet:?xt=urn:btih:631a31dd0a46257d5078c0dee4e66e26f73e42ac&xt=urn:btmh:" + btmh)
+	assert.NoError(t, err)
+	assert.Equal(t, "631a31dd0a46257d5078c0dee4e66e26f73e42ac", hex.EncodeToString(m.InfoHash))
+	assert.Equal(t, btmh, hex.EncodeToString(m.InfoHashV2))
+}
+
+func TestParseMagnetErrors(t *testing.T) {
+	tests := []string{
+		"http://example.com/?xt=urn:btih:55fcd06474e50f49003f7e93681763afaa4d506d",
+		"magnet:?dn=no+hash",
+		"magnet:?xt=urn:btih:55fcd0",
+		"magnet:?xt=urn:btih:zzfcd06474e50f49003f7e93681763afaa4d506d",
+		"magnet:?xt=urn:btih:KX6NAZDU4UHUSAB7P2JWQF3DV6VE2UD1",
+		"magnet:?xt=urn:btmh:1114caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa",
+		"magnet:?xt=btih:55fcd06474e50f49003f7e93681763afaa4d506d",
+		"magnet:?xt=urn:btih:55fcd06474e50f49003f7e93681763afaa4d506d&xl=-1",
+	}
+
+	for _, s := range tests {
+		_, err := ParseMagnet(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMagnetStringRoundTrip(t *testing.T) {
+	infoHash, _ := hex.DecodeString("55fcd06474e50f49003f7e93681763afaa4d506d")
+	infoHashV2, _ := hex.DecodeString("1220caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e")
+
+	m := MagnetLink{
+		InfoHash:          infoHash,
+		InfoHashV2:        infoHashV2,
+		DisplayName:       "Фильм & сериал = 100% [1080p] +bonus",
+		ExactLength:       12345,
+		Trackers:          []string{"http://bt.t-ru.org/ann?magnet&uk=a b", "udp://opentor.org:2710"},
+		WebSeeds:          []string{"https://example.com/a?b=c"},
+		AcceptableSources: []string{"https://example.com/file.torrent"},
+		Peers:             []string{"10.0.0.1:6881"}}
+
+	s := m.String()
+	assert.NotContains(t, s, " ")
+
+	got, err := ParseMagnet(s)
+	assert.NoError(t, err)
+	assert.Equal(t, m, got)
+}
+
+func TestMagnetString(t *testing.T) {
+	infoHash, _ := hex.DecodeString("55fcd06474e50f49003f7e93681763afaa4d506d")
+
+	m := MagnetLink{InfoHash: infoHash, DisplayName: "a b&c", Trackers: []string{"http://t/ann?x=1&y=2"}}
+
+	assert.Equal(t, "magnet:?xt=urn:btih:55fcd06474e50f49003f7e93681763afaa4d506d&dn=a+b%26c&tr=http%3A%2F%2Ft%2Fann%3Fx%3D1%26y%3D2", m.String())
+}
@@ -0,0 +1,220 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/nxshock/torrentdb/torrent/bencode"
+)
+
+// Максимальный размер .torrent-файла
+const maxMetainfoSize = 50 << 20
+
+// Содержимое .torrent-файла (BEP 3)
+type Metainfo struct {
+	Name         string
+	PieceLength  int64
+	Files        []File
+	AnnounceList [][]string
+	InfoHash     []byte
+	CreationDate time.Time
+	Comment      string
+}
+
+// ParseMetainfo разбирает .torrent-файл
+func ParseMetainfo(r io.Reader) (*Metainfo, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxMetainfoSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxMetainfoSize {
+		return nil, errors.New("metainfo: file is too large")
+	}
+
+	v, err := bencode.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("metainfo: root is not a dictionary")
+	}
+
+	info, ok := root["info"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("metainfo: info dictionary not found")
+	}
+
+	rawInfo, err := bencode.RawValue(data, "info")
+	if err != nil {
+		return nil, err
+	}
+	infoHash := sha1.Sum(rawInfo)
+
+	m := &Metainfo{
+		Name:         utf8String(info, "name"),
+		AnnounceList: parseAnnounceList(root),
+		InfoHash:     infoHash[:],
+		Comment:      utf8String(root, "comment")}
+
+	if m.Name == "" {
+		return nil, errors.New("metainfo: empty name")
+	}
+
+	m.PieceLength, ok = info["piece length"].(int64)
+	if !ok || m.PieceLength <= 0 {
+		return nil, errors.New("metainfo: invalid piece length")
+	}
+
+	if pieces, ok := info["pieces"].(string); !ok || len(pieces)%sha1.Size != 0 {
+		return nil, errors.New("metainfo: invalid pieces")
+	}
+
+	if creationDate, ok := root["creation date"].(int64); ok && creationDate > 0 {
+		m.CreationDate = time.Unix(creationDate, 0)
+	}
+
+	m.Files, err = parseFiles(info, m.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// utf8String возвращает значение ключа с учётом необязательного варианта key.utf-8
+func utf8String(dict map[string]interface{}, key string) string {
+	if s, ok := dict[key+".utf-8"].(string); ok {
+		return s
+	}
+
+	s, _ := dict[key].(string)
+
+	return s
+}
+
+func parseAnnounceList(root map[string]interface{}) [][]string {
+	var announceList [][]string
+
+	if tiers, ok := root["announce-list"].([]interface{}); ok {
+		for _, tier := range tiers {
+			tierList, ok := tier.([]interface{})
+			if !ok {
+				continue
+			}
+
+			var urls []string
+			for _, u := range tierList {
+				if s, ok := u.(string); ok && s != "" {
+					urls = append(urls, s)
+				}
+			}
+
+			if len(urls) > 0 {
+				announceList = append(announceList, urls)
+			}
+		}
+	}
+
+	if len(announceList) == 0 {
+		if announce, ok := root["announce"].(string); ok && announce != "" {
+			announceList = [][]string{{announce}}
+		}
+	}
+
+	return announceList
+}
+
+func parseFiles(info map[string]interface{}, name string) ([]File, error) {
+	// Торрент из одного файла
+	if length, ok := info["length"].(int64); ok {
+		if length < 0 {
+			return nil, errors.New("metainfo: negative length")
+		}
+
+		return []File{{Path: name, Size: uint64(length)}}, nil
+	}
+
+	fileList, ok := info["files"].([]interface{})
+	if !ok || len(fileList) == 0 {
+		return nil, errors.New("metainfo: neither length nor files found")
+	}
+
+	var files []File
+	for i, item := range fileList {
+		fileInfo, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("metainfo: file %d is not a dictionary", i)
+		}
+
+		length, ok := fileInfo["length"].(int64)
+		if !ok || length < 0 {
+			return nil, fmt.Errorf("metainfo: file %d: invalid length", i)
+		}
+
+		pathList, ok := fileInfo["path.utf-8"].([]interface{})
+		if !ok {
+			pathList, ok = fileInfo["path"].([]interface{})
+		}
+		if !ok || len(pathList) == 0 {
+			return nil, fmt.Errorf("metainfo: file %d: invalid path", i)
+		}
+
+		parts := []string{name}
+		for _, part := range pathList {
+			s, ok := part.(string)
+			if !ok {
+				return nil, fmt.Errorf("metainfo: file %d: invalid path", i)
+			}
+			parts = append(parts, s)
+		}
+
+		files = append(files, File{Path: strings.Join(parts, "/"), Size: uint64(length)})
+	}
+
+	return files, nil
+}
+
+// TotalSize возвращает суммарный размер файлов
+func (m *Metainfo) TotalSize() uint64 {
+	var size uint64
+	for _, file := range m.Files {
+		size += file.Size
+	}
+
+	return size
+}
+
+// Torrent возвращает описание торрента на основе метаданных
+func (m *Metainfo) Torrent() *Torrent {
+	return &Torrent{
+		Title:           m.Name,
+		Btih:            m.InfoHash,
+		PublicationTime: m.CreationDate,
+		Size:            m.TotalSize(),
+		Files:           m.Files,
+		Trackers:        m.Trackers()}
+}
+
+// Trackers возвращает адреса трекеров из всех уровней списка анонса без повторов
+func (m *Metainfo) Trackers() []string {
+	var trackers []string
+
+	seen := make(map[string]bool)
+	for _, tier := range m.AnnounceList {
+		for _, tracker := range tier {
+			if !seen[tracker] {
+				seen[tracker] = true
+				trackers = append(trackers, tracker)
+			}
+		}
+	}
+
+	return trackers
+}
@@ -0,0 +1,111 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/torrent/bencode"
+)
+
+func encodeMetainfo(t *testing.T, root map[string]interface{}) []byte {
+	b, err := bencode.Encode(root)
+	assert.NoError(t, err)
+
+	return b
+}
+
+func TestParseMetainfoMultiFile(t *testing.T) {
+	info := map[string]interface{}{
+		"name":         "Release",
+		"piece length": int64(262144),
+		"pieces":       strings.Repeat("x", 40),
+		"files": []interface{}{
+			map[string]interface{}{"length": int64(100), "path": []interface{}{"video.mkv"}},
+			map[string]interface{}{"length": int64(20), "path": []interface{}{"Subs", "rus.srt"}},
+		},
+	}
+
+	data := encodeMetainfo(t, map[string]interface{}{
+		"announce":      "http://tracker.example/announce",
+		"announce-list": []interface{}{[]interface{}{"http://a.example/announce", "udp://b.example:80"}, []interface{}{"http://c.example/announce"}},
+		"creation date": int64(1591711281),
+		"comment":       "test",
+		"info":          info,
+	})
+
+	rawInfo, err := bencode.Encode(info)
+	assert.NoError(t, err)
+	expectedHash := sha1.Sum(rawInfo)
+
+	m, err := ParseMetainfo(bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Release", m.Name)
+	assert.Equal(t, int64(262144), m.PieceLength)
+	assert.Equal(t, expectedHash[:], m.InfoHash)
+	assert.Equal(t, [][]string{{"http://a.example/announce", "udp://b.example:80"}, {"http://c.example/announce"}}, m.AnnounceList)
+	assert.Equal(t, []File{{"Release/video.mkv", 100}, {"Release/Subs/rus.srt", 20}}, m.Files)
+	assert.Equal(t, time.Unix(1591711281, 0), m.CreationDate)
+
+	torrent := m.Torrent()
+	assert.Equal(t, "Release", torrent.Title)
+	assert.Equal(t, uint64(120), torrent.Size)
+	assert.Equal(t, expectedHash[:], torrent.Btih)
+	assert.Len(t, torrent.Files, 2)
+	assert.Equal(t, []string{"http://a.example/announce", "udp://b.example:80", "http://c.example/announce"}, torrent.Trackers)
+}
+
+func TestParseMetainfoSingleFile(t *testing.T) {
+	data := encodeMetainfo(t, map[string]interface{}{
+		"announce": "http://tracker.example/announce",
+		"info": map[string]interface{}{
+			"name":         "file.iso",
+			"name.utf-8":   "файл.iso",
+			"piece length": int64(16384),
+			"pieces":       strings.Repeat("x", 20),
+			"length":       int64(12345),
+		},
+	})
+
+	m, err := ParseMetainfo(bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "файл.iso", m.Name)
+	assert.Equal(t, [][]string{{"http://tracker.example/announce"}}, m.AnnounceList)
+	assert.Equal(t, []File{{"файл.iso", 12345}}, m.Files)
+	assert.Equal(t, uint64(12345), m.TotalSize())
+}
+
+func TestParseMetainfoInfoHashUsesRawBytes(t *testing.T) {
+	// Ключи словаря info не отсортированы, поэтому перекодирование
+	// изменило бы хеш
+	rawInfo := "d6:lengthi1e4:name1:a12:piece lengthi1e6:pieces20:" + strings.Repeat("x", 20) + "e"
+	data := []byte("d4:info" + rawInfo + "e")
+
+	m, err := ParseMetainfo(bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	expectedHash := sha1.Sum([]byte(rawInfo))
+	assert.Equal(t, expectedHash[:], m.InfoHash)
+}
+
+func TestParseMetainfoErrors(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"announce": "x"},
+		{"info": "not a dict"},
+		{"info": map[string]interface{}{"name": "a", "piece length": int64(0), "pieces": "", "length": int64(1)}},
+		{"info": map[string]interface{}{"name": "a", "piece length": int64(1), "pieces": "short", "length": int64(1)}},
+		{"info": map[string]interface{}{"name": "a", "piece length": int64(1), "pieces": ""}},
+		{"info": map[string]interface{}{"piece length": int64(1), "pieces": "", "length": int64(1)}},
+	}
+
+	for _, test := range tests {
+		_, err := ParseMetainfo(bytes.NewReader(encodeMetainfo(t, test)))
+		assert.Error(t, err)
+	}
+}
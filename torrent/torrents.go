@@ -8,14 +8,111 @@ import (
 )
 
 type Torrent struct {
+	// Источник и ID темы на нём, заполняются при чтении из БД
+	SourceID int
+	TopicID  int
+
 	Title           string
 	Body            template.HTML
 	Btih            []byte
 	PublicationTime time.Time
 	Size            uint64
+
+	// Категория в общей классификации и ID раздела/категории на источнике
+	Category         Category
+	SourceCategoryID int
+
+	// Статистика раздачи
+	Stats
+
+	// Список файлов, если известен
+	Files []File
+
+	// Адреса анонса трекеров
+	Trackers []string
+
+	// Время последнего изменения названия, хеша или размера на источнике,
+	// нулевое значение - торрент не изменялся
+	ChangeTime time.Time
+
+	// Время обнаружения удаления темы на источнике,
+	// нулевое значение - тема доступна
+	RemoveTime time.Time
+
+	// Предыдущие версии, если загружены
+	History []Revision
+
+	// Все темы источников с этим хешем, если загружены
+	Listings []Listing
+}
+
+// Тема источника, в которой опубликован торрент
+type Listing struct {
+	SourceID        int
+	TopicID         int
+	Title           string
+	PublicationTime time.Time
+
+	// Статистика раздачи по данным источника
+	Stats
+
+	// Время обнаружения удаления темы, нулевое значение - тема доступна
+	RemoveTime time.Time
+}
+
+func (l *Listing) HumanTime() template.HTML {
+	return template.HTML(l.PublicationTime.Format("02.01.06&nbsp;15:04"))
+}
+
+// IsRemoved сообщает, удалена ли тема на источнике
+func (l *Listing) IsRemoved() bool {
+	return !l.RemoveTime.IsZero()
+}
+
+// Предыдущая версия торрента на источнике
+type Revision struct {
+	Title string
+	Btih  []byte
+	Size  uint64
+
+	// Время замены версии на более новую
+	ReplaceTime time.Time
+}
+
+func (r *Revision) BtihHex() string {
+	return hex.EncodeToString(r.Btih)
+}
+
+func (r *Revision) HumanSize() template.HTML {
+	return humanSize(r.Size)
+}
+
+func (r *Revision) HumanTime() template.HTML {
+	return template.HTML(r.ReplaceTime.Format("02.01.06&nbsp;15:04"))
+}
+
+// Статистика раздачи
+type Stats struct {
+	Seeders   int
+	Leechers  int
+	Completed int
+
+	// Время получения статистики, нулевое значение - статистика неизвестна
+	UpdateTime time.Time
+}
+
+// Файл торрента
+type File struct {
+	// Путь к файлу с разделителем "/"
+	Path string
+	Size uint64
 }
 
 func (t *Torrent) HumanSize() template.HTML {
+	return humanSize(t.Size)
+}
+
+func humanSize(size uint64) template.HTML {
 	type sizeInfo struct {
 		s    uint64
 		name string
@@ -29,18 +126,40 @@ func (t *Torrent) HumanSize() template.HTML {
 		{1 << 10, "KiB"}}
 
 	for _, v := range sizesInfo {
-		if t.Size/v.s > 0 {
-			return template.HTML(fmt.Sprintf("%.1f&nbsp;%s", float64(t.Size)/float64(v.s), v.name))
+		if size/v.s > 0 {
+			return template.HTML(fmt.Sprintf("%.1f&nbsp;%s", float64(size)/float64(v.s), v.name))
 		}
 	}
 
-	return template.HTML(fmt.Sprintf("%d&nbsp;%s", t.Size, "B"))
+	return template.HTML(fmt.Sprintf("%d&nbsp;%s", size, "B"))
 }
 
 func (t *Torrent) HumanTime() template.HTML {
 	return template.HTML(t.PublicationTime.Format("02.01.06&nbsp;15:04"))
 }
 
+// IsChanged сообщает, изменялся ли торрент на источнике после загрузки
+func (t *Torrent) IsChanged() bool {
+	return !t.ChangeTime.IsZero()
+}
+
+// IsRemoved сообщает, удалена ли тема на источнике
+func (t *Torrent) IsRemoved() bool {
+	return !t.RemoveTime.IsZero()
+}
+
+// HasStats сообщает, известна ли статистика раздачи
+func (t *Torrent) HasStats() bool {
+	return !t.Stats.UpdateTime.IsZero()
+}
+
 func (t *Torrent) BtihHex() string {
 	return hex.EncodeToString(t.Btih)
 }
+
+// Magnet возвращает magnet-ссылку на торрент
+func (t *Torrent) Magnet() string {
+	magnetLink := MagnetLink{InfoHash: t.Btih, DisplayName: t.Title, ExactLength: t.Size, Trackers: t.Trackers}
+
+	return magnetLink.String()
+}
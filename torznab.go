@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+// Реализация протокола Torznab для использования в качестве индексатора
+// (https://torznab.github.io/spec-1.3-draft/torznab/Specification-v1.3.html)
+
+const (
+	torznabNamespace    = "http://torznab.com/schemas/2015/feed"
+	torznabDefaultLimit = 100
+	torznabMaxLimit     = 100
+)
+
+// Соответствие категорий стандартным категориям Newznab
+var torznabCategories = map[torrent.Category]torznabCategory{
+	torrent.CategoryMovies:     {2000, "Movies"},
+	torrent.CategoryTV:         {5000, "TV"},
+	torrent.CategoryMusic:      {3000, "Audio"},
+	torrent.CategoryAudiobooks: {3030, "Audio/Audiobook"},
+	torrent.CategoryBooks:      {7000, "Books"},
+	torrent.CategorySoftware:   {4000, "PC"},
+	torrent.CategoryGames:      {4050, "PC/Games"},
+	torrent.CategoryOther:      {8000, "Other"}}
+
+// Коды ошибок Torznab
+const (
+	torznabErrorIncorrectCredentials = 100
+	torznabErrorMissingParameter     = 200
+	torznabErrorIncorrectParameter   = 201
+	torznabErrorNoSuchFunction       = 202
+	torznabErrorUnknown              = 900
+)
+
+type torznabCaps struct {
+	XMLName xml.Name `xml:"caps"`
+	Server  struct {
+		Title string `xml:"title,attr"`
+	} `xml:"server"`
+	Limits struct {
+		Max     int `xml:"max,attr"`
+		Default int `xml:"default,attr"`
+	} `xml:"limits"`
+	Searching struct {
+		Search      torznabSearchCaps `xml:"search"`
+		TvSearch    torznabSearchCaps `xml:"tv-search"`
+		MovieSearch torznabSearchCaps `xml:"movie-search"`
+	} `xml:"searching"`
+	Categories struct {
+		Categories []torznabCategory `xml:"category"`
+	} `xml:"categories"`
+}
+
+type torznabSearchCaps struct {
+	Available       string `xml:"available,attr"`
+	SupportedParams string `xml:"supportedParams,attr"`
+}
+
+type torznabCategory struct {
+	ID   int    `xml:"id,attr"`
+	Name string `xml:"name,attr"`
+}
+
+type torznabRss struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Torznab string   `xml:"xmlns:torznab,attr"`
+	Channel struct {
+		Title string        `xml:"title"`
+		Link  string        `xml:"link"`
+		Items []torznabItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type torznabItem struct {
+	Title     string `xml:"title"`
+	Guid      string `xml:"guid"`
+	Link      string `xml:"link"`
+	Comments  string `xml:"comments"`
+	PubDate   string `xml:"pubDate"`
+	Size      uint64 `xml:"size"`
+	Category  int    `xml:"category"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length uint64 `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	Attrs []torznabAttr `xml:"torznab:attr"`
+}
+
+type torznabAttr struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type torznabError struct {
+	XMLName     xml.Name `xml:"error"`
+	Code        int      `xml:"code,attr"`
+	Description string   `xml:"description,attr"`
+}
+
+func torznabHandler(w http.ResponseWriter, r *http.Request) {
+	if config.Main.TorznabApiKey != "" && subtle.ConstantTimeCompare([]byte(r.FormValue("apikey")), []byte(config.Main.TorznabApiKey)) != 1 {
+		writeTorznabError(w, torznabErrorIncorrectCredentials, "Incorrect user credentials")
+		return
+	}
+
+	switch r.FormValue("t") {
+	case "caps":
+		torznabCapsHandler(w, r)
+	case "search", "tvsearch", "movie":
+		torznabSearchHandler(w, r)
+	case "":
+		writeTorznabError(w, torznabErrorMissingParameter, "Missing parameter (t)")
+	default:
+		writeTorznabError(w, torznabErrorNoSuchFunction, "No such function")
+	}
+}
+
+func torznabCapsHandler(w http.ResponseWriter, r *http.Request) {
+	var caps torznabCaps
+
+	caps.Server.Title = "torrentdb"
+	caps.Limits.Max = torznabMaxLimit
+	caps.Limits.Default = torznabDefaultLimit
+	caps.Searching.Search = torznabSearchCaps{"yes", "q"}
+	caps.Searching.TvSearch = torznabSearchCaps{"yes", "q"}
+	caps.Searching.MovieSearch = torznabSearchCaps{"yes", "q"}
+	for _, category := range torrent.Categories() {
+		caps.Categories.Categories = append(caps.Categories.Categories, torznabCategories[category])
+	}
+
+	writeTorznabResponse(w, caps)
+}
+
+func torznabSearchHandler(w http.ResponseWriter, r *http.Request) {
+	limit := torznabDefaultLimit
+	if s := r.FormValue("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			writeTorznabError(w, torznabErrorIncorrectParameter, "Incorrect parameter (limit)")
+			return
+		}
+		if limit > torznabMaxLimit {
+			limit = torznabMaxLimit
+		}
+	}
+
+	var offset int
+	if s := r.FormValue("offset"); s != "" {
+		var err error
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			writeTorznabError(w, torznabErrorIncorrectParameter, "Incorrect parameter (offset)")
+			return
+		}
+	}
+
+	var categories []torrent.Category
+	if s := r.FormValue("cat"); s != "" {
+		for _, idStr := range strings.Split(s, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(idStr))
+			if err != nil {
+				writeTorznabError(w, torznabErrorIncorrectParameter, "Incorrect parameter (cat)")
+				return
+			}
+
+			categories = append(categories, torznabCategoriesByID(id)...)
+		}
+
+		// Ни одна из запрошенных категорий не поддерживается
+		if len(categories) == 0 {
+			writeTorznabResponse(w, newTorznabRss(r))
+			return
+		}
+	}
+
+	var (
+		torrents []*torrent.Torrent
+		err      error
+	)
+
+	// Запрос без текста используется клиентами для получения новых раздач
+	query := strings.TrimSpace(r.FormValue("q"))
+	if query == "" {
+		torrents, err = db.GetLatestTorrents(categories, limit, offset)
+	} else {
+		torrents, err = db.SearchTorrentsByTitle(query, categories, FieldTime, SortDirectionDesc, limit, offset)
+	}
+	if err != nil {
+		log.Printf("Torznab search error: %v", err)
+		writeTorznabError(w, torznabErrorUnknown, "Database error")
+		return
+	}
+
+	baseURL := requestBaseURL(r)
+	rss := newTorznabRss(r)
+
+	for _, t := range torrents {
+		magnet := t.Magnet()
+		category := torznabCategories[t.Category].ID
+		pageURL := baseURL + "/torrent?btih=" + t.BtihHex()
+
+		item := torznabItem{
+			Title:    t.Title,
+			Guid:     t.BtihHex(),
+			Link:     pageURL,
+			Comments: pageURL,
+			PubDate:  t.PublicationTime.Format(time.RFC1123Z),
+			Size:     t.Size,
+			Category: category}
+		// Файлы .torrent не хранятся, поэтому вложение - magnet-ссылка
+		// с соответствующим типом, чтобы клиенты не скачивали её как файл
+		item.Enclosure.URL = magnet
+		item.Enclosure.Length = t.Size
+		item.Enclosure.Type = "application/x-bittorrent;x-scheme-handler/magnet"
+		item.Attrs = []torznabAttr{
+			{"category", strconv.Itoa(category)},
+			{"size", strconv.FormatUint(t.Size, 10)},
+			{"infohash", t.BtihHex()},
+			{"magneturl", magnet}}
+		if t.HasStats() {
+			item.Attrs = append(item.Attrs,
+				torznabAttr{"seeders", strconv.Itoa(t.Seeders)},
+				torznabAttr{"peers", strconv.Itoa(t.Seeders + t.Leechers)},
+				torznabAttr{"grabs", strconv.Itoa(t.Completed)})
+		}
+
+		rss.Channel.Items = append(rss.Channel.Items, item)
+	}
+
+	writeTorznabResponse(w, rss)
+}
+
+func newTorznabRss(r *http.Request) torznabRss {
+	rss := torznabRss{Version: "2.0", Torznab: torznabNamespace}
+	rss.Channel.Title = "torrentdb"
+	rss.Channel.Link = requestBaseURL(r)
+
+	return rss
+}
+
+// torznabCategoriesByID возвращает категории, соответствующие категории Newznab.
+// Родительская категория (например, 3000) включает все дочерние (3030),
+// а запрос дочерней категории без прямого соответствия - её родителя.
+func torznabCategoriesByID(id int) (categories []torrent.Category) {
+	for _, category := range torrent.Categories() {
+		categoryID := torznabCategories[category].ID
+		if categoryID == id || (id%1000 == 0 && categoryID/1000 == id/1000) {
+			categories = append(categories, category)
+		}
+	}
+
+	if len(categories) > 0 || id%1000 == 0 {
+		return categories
+	}
+
+	return torznabCategoriesByID(id / 1000 * 1000)
+}
+
+// requestBaseURL возвращает адрес сервера, по которому пришёл запрос
+func requestBaseURL(r *http.Request) string {
+	u := url.URL{Scheme: "http", Host: r.Host}
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	return u.String()
+}
+
+func writeTorznabResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	w.Write([]byte(xml.Header))
+	err := xml.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("Write torznab response error: %v", err)
+	}
+}
+
+func writeTorznabError(w http.ResponseWriter, code int, description string) {
+	writeTorznabResponse(w, torznabError{Code: code, Description: description})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+func TestTorznabCategoriesByID(t *testing.T) {
+	tests := []struct {
+		id       int
+		expected []torrent.Category
+	}{
+		{2000, []torrent.Category{torrent.CategoryMovies}},
+		{2040, []torrent.Category{torrent.CategoryMovies}}, // дочерняя категория без соответствия
+		{3000, []torrent.Category{torrent.CategoryMusic, torrent.CategoryAudiobooks}},
+		{3030, []torrent.Category{torrent.CategoryAudiobooks}},
+		{3010, []torrent.Category{torrent.CategoryMusic, torrent.CategoryAudiobooks}},
+		{4000, []torrent.Category{torrent.CategorySoftware, torrent.CategoryGames}},
+		{4050, []torrent.Category{torrent.CategoryGames}},
+		{5000, []torrent.Category{torrent.CategoryTV}},
+		{5070, []torrent.Category{torrent.CategoryTV}},
+		{7000, []torrent.Category{torrent.CategoryBooks}},
+		{8000, []torrent.Category{torrent.CategoryOther}},
+		{6000, nil},
+		{6010, nil},
+		{0, nil},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, torznabCategoriesByID(test.id), "%d", test.id)
+	}
+}
+
+// torznabTestResponse - часть ответа Torznab, проверяемая в тестах
+type torznabTestResponse struct {
+	XMLName xml.Name
+	Code    int `xml:"code,attr"`
+	Items   []struct {
+		Title    string `xml:"title"`
+		Guid     string `xml:"guid"`
+		Category int    `xml:"category"`
+	} `xml:"channel>item"`
+	Categories []torznabCategory `xml:"categories>category"`
+}
+
+func serveTorznabRequest(t *testing.T, target string) torznabTestResponse {
+	t.Helper()
+
+	w := serveTestRequest(torznabHandler, target)
+	assert.Equal(t, http.StatusOK, w.Code, target)
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"), target)
+
+	var response torznabTestResponse
+	assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &response), target)
+
+	return response
+}
+
+func TestTorznabHandler(t *testing.T) {
+	newTestDb(t)
+
+	insertTestTorrent(t, testSourceID, 1, "Movie one", 1, torrent.CategoryMovies)
+	insertTestTorrent(t, testSourceID, 2, "Series one", 2, torrent.CategoryTV)
+	insertTestTorrent(t, testSourceID, 3, "Audiobook", 3, torrent.CategoryAudiobooks)
+
+	caps := serveTorznabRequest(t, "/torznab/api?t=caps")
+	assert.Equal(t, "caps", caps.XMLName.Local)
+	assert.Len(t, caps.Categories, len(torrent.Categories()))
+
+	tests := []struct {
+		target   string
+		expected []string // guid найденных торрентов
+	}{
+		{"/torznab/api?t=search&q=one", []string{"02", "01"}},
+		{"/torznab/api?t=movie&q=one&cat=2000", []string{"01"}},
+		{"/torznab/api?t=search&cat=3000,5000", []string{"03", "02"}},
+		{"/torznab/api?t=search&cat=6000", nil}, // неподдерживаемая категория
+		{"/torznab/api?t=tvsearch&limit=1&offset=1", []string{"02"}},
+		{"/torznab/api?t=search&q=missing", nil},
+	}
+
+	for _, test := range tests {
+		response := serveTorznabRequest(t, test.target)
+		assert.Equal(t, "rss", response.XMLName.Local, test.target)
+
+		var guids []string
+		for _, item := range response.Items {
+			guids = append(guids, item.Guid)
+		}
+		assert.Equal(t, test.expected, guids, test.target)
+	}
+
+	w := serveTestRequest(torznabHandler, "/torznab/api?t=movie&q=movie")
+	assert.Contains(t, w.Body.String(), `<category>2000</category>`)
+	assert.Contains(t, w.Body.String(), `<torznab:attr name="infohash" value="01"></torznab:attr>`)
+	assert.Contains(t, w.Body.String(), `<link>http://example.com/torrent?btih=01</link>`)
+	assert.Contains(t, w.Body.String(), `<comments>http://example.com/torrent?btih=01</comments>`)
+	assert.Contains(t, w.Body.String(), `type="application/x-bittorrent;x-scheme-handler/magnet"`)
+}
+
+func TestTorznabHandlerErrors(t *testing.T) {
+	newTestDb(t)
+
+	tests := []struct {
+		target   string
+		expected int
+	}{
+		{"/torznab/api", torznabErrorMissingParameter},
+		{"/torznab/api?t=music", torznabErrorNoSuchFunction},
+		{"/torznab/api?t=search&limit=0", torznabErrorIncorrectParameter},
+		{"/torznab/api?t=search&offset=-1", torznabErrorIncorrectParameter},
+		{"/torznab/api?t=search&cat=movies", torznabErrorIncorrectParameter},
+	}
+
+	for _, test := range tests {
+		response := serveTorznabRequest(t, test.target)
+		assert.Equal(t, "error", response.XMLName.Local, test.target)
+		assert.Equal(t, test.expected, response.Code, test.target)
+	}
+
+	config.Main.TorznabApiKey = "secret"
+
+	response := serveTorznabRequest(t, "/torznab/api?t=caps&apikey=wrong")
+	assert.Equal(t, "error", response.XMLName.Local)
+	assert.Equal(t, torznabErrorIncorrectCredentials, response.Code)
+
+	response = serveTorznabRequest(t, "/torznab/api?t=caps&apikey=secret")
+	assert.Equal(t, "caps", response.XMLName.Local)
+}
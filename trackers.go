@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nxshock/torrentdb/scrape"
+	"github.com/nxshock/torrentdb/torrent"
+)
+
+// Трекер торрента, у которого запрашивается статистика
+type ScrapeTarget struct {
+	SourceID int
+	TopicID  int
+	Btih     []byte
+	Tracker  string
+}
+
+func scrapeTrackersAll() {
+	drivers := enabledSources()
+	for _, driverName := range drivers {
+		err := scrapeTrackers(driverName)
+		if err == errUpdateInterrupted {
+			log.Printf("%s: %v", driverName, err)
+			return
+		} else if err != nil {
+			log.Printf("Scrape %s trackers error: %v", driverName, err)
+		}
+	}
+}
+
+// scrapeTrackers запрашивает у трекеров статистику торрентов источника,
+// опубликованных за последние StatsMaxAge. Статистика сохраняется для
+// каждого трекера, а максимальные значения среди ответивших трекеров -
+// отдельно от статистики источника, которую обновляет updateStats.
+func scrapeTrackers(driverName string) error {
+	source, err := openSource(driverName)
+	if err != nil {
+		return err
+	}
+
+	targets, err := db.GetScrapeTargets(source.ID(), time.Now().Add(-config.Main.StatsMaxAge.Duration))
+	if err != nil {
+		return err
+	}
+
+	// Цели упорядочены по адресу трекера
+	var trackers [][]*ScrapeTarget
+	for i, target := range targets {
+		if i == 0 || target.Tracker != targets[i-1].Tracker {
+			trackers = append(trackers, nil)
+		}
+		trackers[len(trackers)-1] = append(trackers[len(trackers)-1], target)
+	}
+
+	log.Printf("Опрос %d трекеров %s (торрентов на трекерах: %d)", len(trackers), driverName, len(targets))
+
+	// Адреса трекеров берутся из страниц источников и не должны вести в локальную сеть
+	client := scrape.NewClient(config.Main.ScrapeTimeout.Duration)
+	client.Dialer.Control = denyPrivateAddress
+	bestStats := make(map[int]*torrent.Stats)
+
+	var (
+		interrupted bool
+		errorCount  int
+	)
+	for i, trackerTargets := range trackers {
+		select {
+		case <-stopUpdate:
+			interrupted = true
+		default:
+		}
+		if interrupted {
+			break
+		}
+
+		err = scrapeTracker(client, trackerTargets, bestStats)
+		if err == scrape.ErrNotSupported {
+			continue
+		} else if err != nil {
+			errorCount++
+			log.Printf("Scrape %s error: %v", trackerTargets[0].Tracker, err)
+		}
+
+		if showProgress {
+			fmt.Fprintf(os.Stderr, "\rProcessed %d / %d trackers (errors: %d)...", i+1, len(trackers), errorCount)
+		}
+	}
+	if showProgress && len(trackers) > 0 {
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+
+	// Сохранение полученной статистики и при прерывании опроса
+	err = saveTrackerStats(source.ID(), bestStats)
+	if err != nil {
+		return err
+	}
+
+	if interrupted {
+		return errUpdateInterrupted
+	}
+
+	log.Printf("Scrape of %s trackers completed (torrents updated: %d, tracker errors: %d).", driverName, len(bestStats), errorCount)
+
+	return nil
+}
+
+// scrapeTracker опрашивает один трекер и сохраняет полученную статистику,
+// обновляя максимальные значения для торрентов в bestStats
+func scrapeTracker(client *scrape.Client, targets []*ScrapeTarget, bestStats map[int]*torrent.Stats) error {
+	infoHashes := make([]scrape.InfoHash, 0, len(targets))
+	for _, target := range targets {
+		var infoHash scrape.InfoHash
+		copy(infoHash[:], target.Btih)
+
+		infoHashes = append(infoHashes, infoHash)
+	}
+
+	results, err := client.Scrape(targets[0].Tracker, infoHashes)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i, target := range targets {
+		result, ok := results[infoHashes[i]]
+		if !ok {
+			continue
+		}
+
+		stats := &torrent.Stats{Seeders: result.Seeders, Leechers: result.Leechers, Completed: result.Completed, UpdateTime: now}
+
+		err = db.UpdateTrackerStatsWithTx(tx, target, stats)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("save tracker stats %d: %v", target.TopicID, err)
+		}
+
+		best := bestStats[target.TopicID]
+		if best == nil {
+			bestStats[target.TopicID] = stats
+			continue
+		}
+
+		best.Seeders = maxInt(best.Seeders, stats.Seeders)
+		best.Leechers = maxInt(best.Leechers, stats.Leechers)
+		best.Completed = maxInt(best.Completed, stats.Completed)
+	}
+
+	return tx.Commit()
+}
+
+// saveTrackerStats сохраняет максимальные значения статистики трекеров для торрентов
+func saveTrackerStats(sourceID int, bestStats map[int]*torrent.Stats) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for topicID, stats := range bestStats {
+		err = db.UpdateTopicTrackerStatsWithTx(tx, sourceID, topicID, stats)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("save tracker stats %d: %v", topicID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}